@@ -2,32 +2,172 @@ package app
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/NuttapolCha/test-band-data-feeder/cache"
+	"github.com/NuttapolCha/test-band-data-feeder/clock"
 	"github.com/NuttapolCha/test-band-data-feeder/connector"
 	"github.com/NuttapolCha/test-band-data-feeder/log"
+	"github.com/spf13/viper"
 )
 
 type App struct {
 	logger     log.Logger
 	ctx        context.Context
 	httpClient *connector.CustomHttpClient
+	cache      cache.PricingStore
+	clock      clock.Clock
+	health     *healthState
+
+	// sinks are added and removed around feeding cycles
+	sinksMu     sync.Mutex
+	reportSinks []ReportSink
+
+	// *FeederConfig and *TimeConfig, swapped as a whole on reload from configSource
+	configSource ConfigSource
+	feederConfig atomic.Value
+	timeConfig   atomic.Value
+	serverConfig *ServerConfig
+
+	// settings applied once at starting, changes are not reloaded
+	startConfig map[string]string
+
+	// a feeding cycle and swapping config never overlap
+	feedLock sync.Mutex
+
+	observations *deviationObservations
+
+	// signalled after the feeding interval has been reloaded
+	rescheduled chan struct{}
+}
+
+// Config is what the application is configured with.
+type Config struct {
+	Feeder *FeederConfig
+	Time   *TimeConfig
+	Server *ServerConfig
+
+	// log, HTTP client and server settings keyed by config key, they are applied once at starting
+	startConfig map[string]string
+}
+
+// LoadConfig reads and validates config from v, see also ViperSource.Check.
+func LoadConfig(v *viper.Viper) (*Config, error) {
+	feederConfig, err := loadFeederConfig(v)
+	if err != nil {
+		return nil, err
+	}
+	timeConfig, err := loadTimeConfig(v)
+	if err != nil {
+		return nil, err
+	}
+	serverConfig := loadServerConfig(v)
+	startConfig := serverConfig.describe()
+	for _, d := range []map[string]string{log.Describe(v), connector.Describe(v)} {
+		for key, val := range d {
+			startConfig[key] = val
+		}
+	}
+	return &Config{
+		Feeder:      feederConfig,
+		Time:        timeConfig,
+		Server:      serverConfig,
+		startConfig: startConfig,
+	}, nil
 }
 
-func New(logger log.Logger, httpClient *connector.CustomHttpClient) App {
-	return App{
-		logger:     logger,
-		ctx:        context.TODO(),
-		httpClient: httpClient,
+// New initializes application, ctx is the lifetime of the application
+// i.e. once ctx is done, every in-flight feeding will be cancelled.
+// Config is reloaded from source whenever it has changed, nil source never reloads.
+// Latest pricing sent to destination is kept in store and every time based decision is made on clk.
+func New(
+	ctx context.Context,
+	logger log.Logger,
+	config *Config,
+	source ConfigSource,
+	store cache.PricingStore,
+	clk clock.Clock,
+	httpClient *connector.CustomHttpClient,
+) *App {
+	application := &App{
+		logger:       logger,
+		ctx:          ctx,
+		httpClient:   httpClient,
+		cache:        store,
+		clock:        clk,
+		health:       newHealthState(clk.Now()),
+		configSource: source,
+		serverConfig: config.Server,
+		startConfig:  config.startConfig,
+		observations: newDeviationObservations(),
+		rescheduled:  make(chan struct{}, 1),
 	}
+	application.feederConfig.Store(config.Feeder)
+	application.timeConfig.Store(config.Time)
+	for _, symbol := range config.Feeder.symbols {
+		feedSymbolMetrics(symbol)
+	}
+	application.reportSinks = []ReportSink{
+		&logReportSink{logger: logger},
+		&metricsReportSink{feederConfig: application.getFeederConfig, cache: store},
+		application.health,
+	}
+	return application
 }
 
-func schedule(f func(), d time.Duration) *time.Ticker {
-	ticker := time.NewTicker(d)
+// schedule calls f every interval() until ctx is done, the ticker is reprogrammed
+// once rescheduled is signalled and interval() has changed.
+// The returned channel is closed after f has returned for the last time.
+func schedule(ctx context.Context, clk clock.Clock, f func(context.Context), interval func() time.Duration, rescheduled <-chan struct{}) <-chan struct{} {
+	d := interval()
+	ticker := clk.NewTicker(d)
+	stopped := make(chan struct{})
 	go func() {
-		for range ticker.C {
-			f()
+		defer close(stopped)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-rescheduled:
+				if next := interval(); next != d {
+					d = next
+					ticker.Reset(d)
+				}
+			case <-ticker.C():
+				f(ctx)
+			}
 		}
 	}()
-	return ticker
+	return stopped
+}
+
+// runConcurrently calls f(0) to f(n-1) using at most concurrency goroutines
+// and returns after every call has returned.
+func runConcurrently(concurrency, n int, f func(i int)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > n {
+		concurrency = n
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for w := 0; w < concurrency; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				f(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
 }
@@ -0,0 +1,433 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/NuttapolCha/test-band-data-feeder/connector"
+	"github.com/NuttapolCha/test-band-data-feeder/log"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// configKey is a known config key and the check of an explicitly set value.
+// Defaults are applied where the key is read, see effectiveConfig.
+type configKey struct {
+	key   string
+	check func(v interface{}) error
+}
+
+var configSchema = []configKey{
+	{"Log.Level", oneOf("info", "debug", "verbose")},
+	{"Log.Format", oneOf("console", "json")},
+	{"Log.Output", stringOrList},
+	{"Log.Rotation.MaxSize", intAtLeast(1)},
+	{"Log.Rotation.MaxAge", intAtLeast(0)},
+	{"Log.Rotation.MaxBackups", intAtLeast(0)},
+	{"Log.Rotation.Compress", boolean},
+
+	{"Server.ListenAddress", str},
+	{"Server.Health.MaxMissedIntervals", intAtLeast(1)},
+
+	{"ExternalAPIs.Timeout", positiveSeconds},
+	{"ExternalAPIs.CircuitBreaker.FailureThreshold", nonZeroInt},
+	{"ExternalAPIs.CircuitBreaker.CoolDown", positiveSeconds},
+	{"ExternalAPIs.DataSource.RetryCount", intAtLeast(1)},
+	{"ExternalAPIs.DataSource.Retry.BaseDelay", positiveSeconds},
+	{"ExternalAPIs.DataSource.Retry.MaxDelay", nonNegativeSeconds},
+	{"ExternalAPIs.DataSource.Retry.Jitter", ratio},
+	{"ExternalAPIs.DataSource.Retry.RetryableStatusCodes", statusCodes},
+	{"ExternalAPIs.DataSource.RequestPricingData", httpURL},
+	{"ExternalAPIs.DataSource.GetPricingData", httpURL},
+	{"ExternalAPIs.Destination.RetryCount", intAtLeast(1)},
+	{"ExternalAPIs.Destination.Retry.BaseDelay", positiveSeconds},
+	{"ExternalAPIs.Destination.Retry.MaxDelay", nonNegativeSeconds},
+	{"ExternalAPIs.Destination.Retry.Jitter", ratio},
+	{"ExternalAPIs.Destination.Retry.RetryableStatusCodes", statusCodes},
+	{"ExternalAPIs.Destination.Concurrency", intAtLeast(1)},
+	{"ExternalAPIs.Destination.UpdatePricingData", httpURL},
+	{"ExternalAPIs.Destination.GetUpdatedPricingData", httpURL},
+
+	{"Cache.FilePath", str},
+	{"Audit.FilePath", str},
+
+	{"DataFeeder.MaximumDelay", intAtLeast(1)},
+	{"DataFeeder.DiffThreshold", positiveFloat},
+	{"DataFeeder.MinUpdateInterval", intAtLeast(0)},
+	{"DataFeeder.ConfirmationCount", intAtLeast(1)},
+	{"DataFeeder.PricePrecision", intAtLeast(0)},
+	{"DataFeeder.Interval", positiveSeconds},
+	{"DataFeeder.CycleTimeout", positiveSeconds},
+	{"DataFeeder.WaitTime", nonNegativeSeconds},
+	{"DataFeeder.PollInitialDelay", positiveSeconds},
+	{"DataFeeder.PollInterval", positiveSeconds},
+	{"DataFeeder.PollDeadline", positiveSeconds},
+	{"DataFeeder.Validation.MaxClockSkew", positiveSeconds},
+	{"DataFeeder.Validation.MaxResultAge", positiveSeconds},
+	{"DataFeeder.EnableRecheck", boolean},
+	{"DataFeeder.Symbols", nil},
+}
+
+// ConfigEntry is an effective config value and where it came from.
+type ConfigEntry struct {
+	Key    string
+	Value  string
+	Source string
+}
+
+// ConfigCheck is the result of checking config loaded into viper, see ViperSource.Check.
+type ConfigCheck struct {
+	Entries  []*ConfigEntry
+	Problems []string
+	Warnings []string
+}
+
+func (c *ConfigCheck) problemf(format string, args ...interface{}) {
+	problem := fmt.Sprintf(format, args...)
+	for _, p := range c.Problems {
+		if p == problem {
+			return
+		}
+	}
+	c.Problems = append(c.Problems, problem)
+}
+
+func (c *ConfigCheck) warnf(format string, args ...interface{}) {
+	c.Warnings = append(c.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Err returns an error listing every problem, nil if there is none.
+func (c *ConfigCheck) Err() error {
+	if len(c.Problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid config:\n  %s", strings.Join(c.Problems, "\n  "))
+}
+
+// WriteTable writes effective config, problems and warnings as a human readable table.
+func (c *ConfigCheck) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+	for _, e := range c.Entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", e.Key, e.Value, e.Source)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, warning := range c.Warnings {
+		fmt.Fprintf(w, "warning: %s\n", warning)
+	}
+	for _, problem := range c.Problems {
+		fmt.Fprintf(w, "error: %s\n", problem)
+	}
+	return nil
+}
+
+// Check checks config loaded into the viper instance for unknown keys, out of range values
+// and inconsistency between values, and resolves the effective config.
+// Explicitly set zero values are checked as well instead of falling back to defaults.
+func (s *ViperSource) Check() *ConfigCheck {
+	v := s.v
+	check := &ConfigCheck{}
+
+	known := make(map[string]bool, len(configSchema))
+	for _, k := range configSchema {
+		known[strings.ToLower(k.key)] = true
+	}
+	for _, key := range v.AllKeys() {
+		if !known[key] {
+			check.problemf("unknown key %s", key)
+		}
+	}
+
+	for _, k := range configSchema {
+		if k.check == nil || !v.IsSet(k.key) {
+			continue
+		}
+		if err := k.check(v.Get(k.key)); err != nil {
+			check.problemf("invalid %s: %v", k.key, err)
+		}
+	}
+
+	if v.IsSet("DataFeeder.WaitTime") {
+		check.warnf("DataFeeder.WaitTime is deprecated, use DataFeeder.PollInitialDelay instead")
+	}
+
+	// invalid config is still read, so the table shows what is in effect rather than blanks
+	loaded := true
+	feederConfig, err := readFeederConfig(v)
+	if err == nil {
+		err = feederConfig.validate()
+	}
+	if err != nil {
+		loaded = false
+		check.problemf("%v", err)
+	}
+	timeConfig := readTimeConfig(v)
+	if err := timeConfig.validate(); err != nil {
+		loaded = false
+		check.problemf("%v", err)
+	}
+
+	effective := effectiveConfig(v, feederConfig, timeConfig)
+	for _, k := range configSchema {
+		if k.key == "DataFeeder.Symbols" {
+			continue
+		}
+		entry := &ConfigEntry{
+			Key:    k.key,
+			Value:  effective[k.key],
+			Source: s.valueOrigin(k.key),
+		}
+		// the key is not read as it is, e.g. the deprecated WaitTime
+		if _, ok := effective[k.key]; !ok && v.IsSet(k.key) {
+			entry.Value = fmt.Sprint(v.Get(k.key))
+		}
+		// PollInitialDelay falls back to WaitTime before its default
+		if k.key == "DataFeeder.PollInitialDelay" && entry.Source == "default" && v.IsSet("DataFeeder.WaitTime") {
+			entry.Source = s.valueOrigin("DataFeeder.WaitTime") + " (DataFeeder.WaitTime)"
+		}
+		check.Entries = append(check.Entries, entry)
+	}
+	if !loaded {
+		return check
+	}
+
+	// the data source must be requested and polled within a cycle
+	if feederConfig.pollInitialDelay >= timeConfig.interval {
+		check.problemf("DataFeeder.PollInitialDelay %v must be less than DataFeeder.Interval %v", feederConfig.pollInitialDelay, timeConfig.interval)
+	}
+	if feederConfig.pollDeadline >= timeConfig.cycleTimeout {
+		check.warnf("DataFeeder.PollDeadline %v is not less than DataFeeder.CycleTimeout %v, cycles will time out while polling", feederConfig.pollDeadline, timeConfig.cycleTimeout)
+	}
+
+	// every symbol is shown with its resolved policy
+	symbolsSource := s.valueOrigin("DataFeeder.Symbols")
+	check.Entries = append(check.Entries, &ConfigEntry{
+		Key:    "DataFeeder.Symbols",
+		Value:  strings.Join(feederConfig.symbols, ","),
+		Source: symbolsSource,
+	})
+	overridden := symbolOverrides(v)
+	for _, symbol := range feederConfig.symbols {
+		d := feederConfig.symbolPolicies[symbol].describe()
+		keys := make([]string, 0, len(d))
+		for key := range d {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			source := s.valueOrigin("DataFeeder." + key)
+			if overridden[symbol][strings.ToLower(key)] {
+				source = symbolsSource
+			}
+			check.Entries = append(check.Entries, &ConfigEntry{
+				Key:    fmt.Sprintf("DataFeeder.Symbols[%s].%s", symbol, key),
+				Value:  d[key],
+				Source: source,
+			})
+		}
+	}
+
+	return check
+}
+
+// effectiveConfig returns values in effect keyed by config key as resolved where they are read,
+// so defaults shown to users are the ones applied.
+func effectiveConfig(v *viper.Viper, feederConfig *FeederConfig, timeConfig *TimeConfig) map[string]string {
+	effective := make(map[string]string)
+	descriptions := []map[string]string{
+		log.Describe(v),
+		connector.Describe(v),
+		loadServerConfig(v).describe(),
+		feederConfig.describe(),
+		timeConfig.describe(),
+	}
+	for _, d := range descriptions {
+		for key, val := range d {
+			effective[key] = val
+		}
+	}
+	return effective
+}
+
+// symbolOverrides returns lower cased keys overridden by each symbol object in DataFeeder.Symbols.
+func symbolOverrides(v *viper.Viper) map[string]map[string]bool {
+	overrides := make(map[string]map[string]bool)
+	items, ok := v.Get("DataFeeder.Symbols").([]interface{})
+	if !ok {
+		return overrides
+	}
+	for _, item := range items {
+		m, err := cast.ToStringMapE(item)
+		if err != nil {
+			continue
+		}
+		keys := make(map[string]bool, len(m))
+		var symbol string
+		for key, val := range m {
+			if strings.ToLower(key) == "symbol" {
+				symbol = strings.ToUpper(strings.TrimSpace(cast.ToString(val)))
+			}
+			keys[strings.ToLower(key)] = true
+		}
+		overrides[symbol] = keys
+	}
+	return overrides
+}
+
+// checks of explicitly set values, durations are in seconds
+
+func oneOf(values ...string) func(v interface{}) error {
+	return func(v interface{}) error {
+		s, err := cast.ToStringE(v)
+		if err != nil {
+			return err
+		}
+		for _, value := range values {
+			if strings.EqualFold(s, value) {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s but got %q", strings.Join(values, ", "), s)
+	}
+}
+
+func str(v interface{}) error {
+	_, err := cast.ToStringE(v)
+	return err
+}
+
+func stringOrList(v interface{}) error {
+	if _, ok := v.(string); ok {
+		return nil
+	}
+	_, err := cast.ToStringSliceE(v)
+	return err
+}
+
+func boolean(v interface{}) error {
+	_, err := cast.ToBoolE(v)
+	return err
+}
+
+func intAtLeast(min int) func(v interface{}) error {
+	return func(v interface{}) error {
+		i, err := integer(v)
+		if err != nil {
+			return err
+		}
+		if i < min {
+			return fmt.Errorf("must be at least %d but got %d", min, i)
+		}
+		return nil
+	}
+}
+
+func nonZeroInt(v interface{}) error {
+	i, err := integer(v)
+	if err != nil {
+		return err
+	}
+	if i == 0 {
+		return errors.New("must not be zero, use a negative value to disable")
+	}
+	return nil
+}
+
+// integer rejects fractions rather than truncating them like cast does.
+func integer(v interface{}) (int, error) {
+	f, err := cast.ToFloat64E(v)
+	if err != nil || f != math.Trunc(f) {
+		return 0, fmt.Errorf("must be an integer but got %q", fmt.Sprint(v))
+	}
+	return int(f), nil
+}
+
+func positiveFloat(v interface{}) error {
+	f, err := cast.ToFloat64E(v)
+	if err != nil {
+		return fmt.Errorf("must be a number but got %q", fmt.Sprint(v))
+	}
+	if f <= 0 {
+		return fmt.Errorf("must be positive but got %v", f)
+	}
+	return nil
+}
+
+func ratio(v interface{}) error {
+	f, err := cast.ToFloat64E(v)
+	if err != nil {
+		return fmt.Errorf("must be a number but got %q", fmt.Sprint(v))
+	}
+	if f < 0 || f > 1 {
+		return fmt.Errorf("must be between 0 and 1 but got %v", f)
+	}
+	return nil
+}
+
+func seconds(v interface{}) (time.Duration, error) {
+	f, err := cast.ToFloat64E(v)
+	if err != nil {
+		return 0, fmt.Errorf("must be a number of seconds but got %q", fmt.Sprint(v))
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
+
+func positiveSeconds(v interface{}) error {
+	d, err := seconds(v)
+	if err != nil {
+		return err
+	}
+	if d <= 0 {
+		return fmt.Errorf("must be positive but got %v", d)
+	}
+	return nil
+}
+
+func nonNegativeSeconds(v interface{}) error {
+	d, err := seconds(v)
+	if err != nil {
+		return err
+	}
+	if d < 0 {
+		return fmt.Errorf("must not be negative but got %v", d)
+	}
+	return nil
+}
+
+func statusCodes(v interface{}) error {
+	codes, err := cast.ToIntSliceE(v)
+	if err != nil {
+		return fmt.Errorf("must be a list of status codes but got %q", fmt.Sprint(v))
+	}
+	for _, code := range codes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("invalid status code %d", code)
+		}
+	}
+	return nil
+}
+
+func httpURL(v interface{}) error {
+	s, err := cast.ToStringE(v)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute http(s) URL", s)
+	}
+	return nil
+}
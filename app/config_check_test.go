@@ -0,0 +1,49 @@
+package app
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func entriesByKey(check *ConfigCheck) map[string]*ConfigEntry {
+	entries := make(map[string]*ConfigEntry, len(check.Entries))
+	for _, e := range check.Entries {
+		entries[e.Key] = e
+	}
+	return entries
+}
+
+func TestCheckInvalidConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfigFile(t, path, "DataFeeder:\n  WaitTime: 2\n  PollDeadline: -1\n")
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatalf("could not read config: %v", err)
+	}
+	check := NewViperSource(v).Check()
+
+	if check.Err() == nil {
+		t.Fatalf("negative DataFeeder.PollDeadline passes the check")
+	}
+	// values in effect are shown even though config cannot be loaded
+	want := map[string]ConfigEntry{
+		"DataFeeder.Interval":         {Value: "10s", Source: "default"},
+		"DataFeeder.PollDeadline":     {Value: "-1s", Source: "file"},
+		"DataFeeder.PollInitialDelay": {Value: "2s", Source: "file (DataFeeder.WaitTime)"},
+		"DataFeeder.MaximumDelay":     {Value: "3600", Source: "default"},
+	}
+	entries := entriesByKey(check)
+	for key, w := range want {
+		e, ok := entries[key]
+		if !ok {
+			t.Errorf("%s: not checked", key)
+			continue
+		}
+		if e.Value != w.Value || e.Source != w.Source {
+			t.Errorf("%s: %q from %s, want %q from %s", key, e.Value, e.Source, w.Value, w.Source)
+		}
+	}
+}
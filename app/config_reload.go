@@ -0,0 +1,96 @@
+package app
+
+// watchConfig reloads feeder and time config whenever the config source has changed
+// until the application is done.
+func (app *App) watchConfig() {
+	logger := app.logger
+
+	if app.configSource == nil {
+		logger.Infof("no config source is given, config will not be reloaded")
+		return
+	}
+	err := app.configSource.Watch(app.ctx, func() {
+		logger.Infof("CONFIG RELOAD: %v has changed", app.configSource)
+		app.reloadConfig()
+	})
+	if err != nil {
+		logger.Infof("config will not be reloaded because: %v", err)
+		return
+	}
+	logger.Infof("watching %v for changes", app.configSource)
+}
+
+// reloadConfig rebuilds feeder and time config from the config source and swaps them between cycles.
+// Invalid config is rejected as a whole, the current one is kept.
+func (app *App) reloadConfig() {
+	logger := app.logger
+
+	config, err := app.configSource.Load()
+	if err != nil {
+		logger.Errorf("CONFIG RELOAD: rejected because: %v, keep using the current config", err)
+		return
+	}
+	newFeederConfig, newTimeConfig := config.Feeder, config.Time
+
+	oldFeederConfig, oldTimeConfig := app.getFeederConfig(), app.getTimeConfig()
+
+	// cache and audit files are opened once at starting
+	if newFeederConfig.cacheFilePath != oldFeederConfig.cacheFilePath {
+		logger.Warnf("CONFIG RELOAD: Cache.FilePath change takes effect after restarting")
+		newFeederConfig.cacheFilePath = oldFeederConfig.cacheFilePath
+	}
+	if newFeederConfig.auditFilePath != oldFeederConfig.auditFilePath {
+		logger.Warnf("CONFIG RELOAD: Audit.FilePath change takes effect after restarting")
+		newFeederConfig.auditFilePath = oldFeederConfig.auditFilePath
+	}
+
+	// the logger, HTTP client and status server are set up once at starting
+	for _, change := range diffDescriptions(app.startConfig, config.startConfig) {
+		logger.Warnf("CONFIG RELOAD: %s takes effect after restarting", change)
+	}
+
+	oldDesc := oldFeederConfig.describe()
+	newDesc := newFeederConfig.describe()
+	for key, val := range oldTimeConfig.describe() {
+		oldDesc[key] = val
+	}
+	for key, val := range newTimeConfig.describe() {
+		newDesc[key] = val
+	}
+	changes := diffDescriptions(oldDesc, newDesc)
+	if len(changes) == 0 {
+		logger.Infof("CONFIG RELOAD: nothing has changed")
+		return
+	}
+
+	// never swap in the middle of a feeding cycle
+	app.feedLock.Lock()
+	app.feederConfig.Store(newFeederConfig)
+	app.timeConfig.Store(newTimeConfig)
+	app.feedLock.Unlock()
+
+	for _, change := range changes {
+		logger.Infof("CONFIG RELOAD: %s", change)
+	}
+
+	for _, symbol := range newFeederConfig.symbols {
+		if _, ok := oldFeederConfig.symbolPolicies[symbol]; !ok {
+			feedSymbolMetrics(symbol)
+		}
+	}
+	for _, symbol := range oldFeederConfig.symbols {
+		if _, ok := newFeederConfig.symbolPolicies[symbol]; !ok {
+			app.observations.reset(symbol)
+			forgetSymbolMetrics(symbol)
+		}
+	}
+
+	if newTimeConfig.interval != oldTimeConfig.interval {
+		select {
+		case app.rescheduled <- struct{}{}:
+		default:
+			// the ticker has yet to be reprogrammed since the last reload
+		}
+	}
+	logger.Infof("CONFIG RELOAD: applied %d changes", len(changes))
+}
@@ -0,0 +1,101 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestReloadConfigOfAppsSharingSource(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfigFile(t, path, "DataFeeder:\n  Symbols: [BTC, ETH]\n")
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatalf("could not read config: %v", err)
+	}
+	source := NewViperSource(v)
+
+	apps := []*App{newFeederTest(t, nil, nil).app, newFeederTest(t, nil, nil).app}
+	for _, app := range apps {
+		app.configSource = source
+		app.watchConfig()
+	}
+
+	// every app reloads, not only the last one watching
+	writeConfigFile(t, path, "DataFeeder:\n  Symbols: [BTC, ETH, ADA]\n")
+	for i, app := range apps {
+		deadline := time.Now().Add(10 * time.Second)
+		for strings.Join(app.getFeederConfig().symbols, ",") != "BTC,ETH,ADA" {
+			if time.Now().After(deadline) {
+				t.Fatalf("app %d: symbols are %v 10s after config has changed", i, app.getFeederConfig().symbols)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestWatchUntilContextIsDone(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfigFile(t, path, "DataFeeder:\n  Symbols: [BTC]\n")
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatalf("could not read config: %v", err)
+	}
+	source := NewViperSource(v)
+
+	// watchers are notified in order, the stopped one would be notified first
+	stopped := make(chan struct{}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := source.Watch(ctx, func() { stopped <- struct{}{} }); err != nil {
+		t.Fatalf("could not watch config: %v", err)
+	}
+	watching := make(chan struct{}, 10)
+	if err := source.Watch(context.Background(), func() { watching <- struct{}{} }); err != nil {
+		t.Fatalf("could not watch config: %v", err)
+	}
+	cancel()
+	// unwatching is asynchronous to cancel
+	deadline := time.Now().Add(10 * time.Second)
+	for watchers(source) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d watchers 10s after cancelling, want 1", watchers(source))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	writeConfigFile(t, path, "DataFeeder:\n  Symbols: [BTC, ETH]\n")
+	select {
+	case <-watching:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("watcher is not notified 10s after config has changed")
+	}
+	select {
+	case <-stopped:
+		t.Errorf("watcher is notified after its context is done")
+	default:
+	}
+}
+
+func watchers(s *ViperSource) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.watchers)
+}
+
+func writeConfigFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("could not write config: %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix prefixes environment variables overriding config,
+// e.g. DataFeeder.Interval is overridden by DATAFEEDER_DATAFEEDER_INTERVAL.
+const EnvPrefix = "DATAFEEDER"
+
+// envKeyReplacer maps config keys to environment variables after the prefix
+var envKeyReplacer = strings.NewReplacer(".", "_")
+
+// EnvName returns the environment variable overriding config key.
+func EnvName(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(envKeyReplacer.Replace(key))
+}
+
+// ConfigSource is where the application config is loaded and reloaded from.
+type ConfigSource interface {
+	// Load reads and validates the whole config.
+	Load() (*Config, error)
+
+	// Watch calls onChange every time config may have changed until ctx is done,
+	// an error is returned if changes cannot be watched.
+	Watch(ctx context.Context, onChange func()) error
+}
+
+// ViperSource loads config from a viper instance and watches the config file it has read.
+// Every watcher is notified, so applications sharing the source reload independently.
+type ViperSource struct {
+	v *viper.Viper
+
+	mu sync.Mutex
+	// flags bound to config keys, keyed by lower cased keys
+	flags    map[string]*pflag.Flag
+	watchers []*watcher
+	// viper cannot stop watching the file, changes are dropped while nobody is watching
+	watching bool
+}
+
+type watcher struct {
+	onChange func()
+}
+
+func NewViperSource(v *viper.Viper) *ViperSource {
+	return &ViperSource{
+		v:     v,
+		flags: make(map[string]*pflag.Flag),
+	}
+}
+
+// BindEnv makes every known config key overridable by its environment variable, see EnvName.
+// Precedence is flag > env > file > default.
+func (s *ViperSource) BindEnv() error {
+	s.v.SetEnvPrefix(EnvPrefix)
+	s.v.SetEnvKeyReplacer(envKeyReplacer)
+	s.v.AutomaticEnv()
+
+	// bound keys are known to viper even if they are not in the config file
+	for _, k := range configSchema {
+		if err := s.v.BindEnv(k.key, EnvName(k.key)); err != nil {
+			return fmt.Errorf("could not bind %s to environment variable because: %w", k.key, err)
+		}
+	}
+	return nil
+}
+
+// BindFlag makes config key overridable by flag once the flag is set.
+func (s *ViperSource) BindFlag(key string, flag *pflag.Flag) error {
+	if err := s.v.BindPFlag(key, flag); err != nil {
+		return fmt.Errorf("could not bind %s to flag --%s because: %w", key, flag.Name, err)
+	}
+	s.mu.Lock()
+	s.flags[strings.ToLower(key)] = flag
+	s.mu.Unlock()
+	return nil
+}
+
+// valueOrigin tells where the effective value of key comes from, either flag, env, file or default.
+func (s *ViperSource) valueOrigin(key string) string {
+	s.mu.Lock()
+	flag, ok := s.flags[strings.ToLower(key)]
+	s.mu.Unlock()
+	if ok && flag.Changed {
+		return "flag"
+	}
+	// viper ignores empty environment variables
+	if val, ok := os.LookupEnv(EnvName(key)); ok && val != "" {
+		return "env"
+	}
+	if s.v.InConfig(key) {
+		return "file"
+	}
+	return "default"
+}
+
+// Load rejects a config file which cannot be parsed, config which does not pass Check
+// and config which cannot be loaded.
+func (s *ViperSource) Load() (*Config, error) {
+	// viper keeps the previous values if the changed file cannot be parsed but notifies anyway,
+	// parsing it on its own tells a broken file from an unchanged one. Values are still loaded
+	// from s.v below so env and flag overrides keep applying.
+	if path := s.v.ConfigFileUsed(); path != "" {
+		if err := parseConfigFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.Check().Err(); err != nil {
+		return nil, err
+	}
+	return LoadConfig(s.v)
+}
+
+// String tells which config file is read.
+func (s *ViperSource) String() string {
+	return s.v.ConfigFileUsed()
+}
+
+func (s *ViperSource) Watch(ctx context.Context, onChange func()) error {
+	if s.v.ConfigFileUsed() == "" {
+		return errors.New("no config file is used")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := &watcher{onChange: onChange}
+	go func() {
+		<-ctx.Done()
+		s.unwatch(w)
+	}()
+
+	s.watchers = append(s.watchers, w)
+	if s.watching {
+		return nil
+	}
+	s.watching = true
+	s.v.OnConfigChange(func(fsnotify.Event) {
+		s.mu.Lock()
+		watchers := append([]*watcher{}, s.watchers...)
+		s.mu.Unlock()
+		for _, w := range watchers {
+			w.onChange()
+		}
+	})
+	s.v.WatchConfig()
+	return nil
+}
+
+func (s *ViperSource) unwatch(w *watcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.watchers {
+		if s.watchers[i] == w {
+			s.watchers = append(s.watchers[:i], s.watchers[i+1:]...)
+			return
+		}
+	}
+}
+
+// parseConfigFile reads the config file at path into a throwaway viper to see whether it can be parsed.
+func parseConfigFile(path string) error {
+	v := viper.New()
+	v.SetConfigFile(path)
+	return v.ReadInConfig()
+}
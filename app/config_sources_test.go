@@ -0,0 +1,78 @@
+package app
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+func TestConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfigFile(t, path, `
+Log:
+  Level: "debug"
+DataFeeder:
+  Interval: 5
+  CycleTimeout: 3
+  PollDeadline: 2
+`)
+	t.Setenv(EnvName("DataFeeder.Interval"), "20")
+	t.Setenv(EnvName("DataFeeder.CycleTimeout"), "6")
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	source := NewViperSource(v)
+	if err := source.BindEnv(); err != nil {
+		t.Fatalf("could not bind env: %v", err)
+	}
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatalf("could not read config: %v", err)
+	}
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.Float64("interval", 0, "")
+	flags.String("log-level", "", "")
+	if err := source.BindFlag("DataFeeder.Interval", flags.Lookup("interval")); err != nil {
+		t.Fatalf("could not bind flag: %v", err)
+	}
+	// a flag which is not set does not override anything
+	if err := source.BindFlag("Log.Level", flags.Lookup("log-level")); err != nil {
+		t.Fatalf("could not bind flag: %v", err)
+	}
+	if err := flags.Parse([]string{"--interval", "7.5"}); err != nil {
+		t.Fatalf("could not parse flags: %v", err)
+	}
+
+	config, err := source.Load()
+	if err != nil {
+		t.Fatalf("could not load config: %v", err)
+	}
+	if config.Time.interval != 7500*time.Millisecond {
+		t.Errorf("interval is %v, want 7.5s of the flag", config.Time.interval)
+	}
+	if config.Time.cycleTimeout != 6*time.Second {
+		t.Errorf("cycle timeout is %v, want 6s of env", config.Time.cycleTimeout)
+	}
+	if config.Feeder.pollDeadline != 2*time.Second {
+		t.Errorf("poll deadline is %v, want 2s of the file", config.Feeder.pollDeadline)
+	}
+	if config.Feeder.pollInterval != time.Second {
+		t.Errorf("poll interval is %v, want the default 1s", config.Feeder.pollInterval)
+	}
+
+	origins := map[string]string{
+		"DataFeeder.Interval":     "flag",
+		"DataFeeder.CycleTimeout": "env",
+		"DataFeeder.PollDeadline": "file",
+		"Log.Level":               "file",
+		"DataFeeder.PollInterval": "default",
+	}
+	for key, want := range origins {
+		if got := source.valueOrigin(key); got != want {
+			t.Errorf("%s comes from %s, want %s", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package app
+
+import "sync"
+
+// deviationObservations counts consecutive observations of each symbol
+// whose price deviates from the destination more than its threshold.
+type deviationObservations struct {
+	mu sync.Mutex
+	m  map[string]int
+}
+
+func newDeviationObservations() *deviationObservations {
+	return &deviationObservations{
+		m: make(map[string]int),
+	}
+}
+
+// observe records one more consecutive deviation of symbol and returns the count.
+func (o *deviationObservations) observe(symbol string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.m[symbol]++
+	return o.m[symbol]
+}
+
+// reset is called when the deviation is gone or destination has been updated.
+func (o *deviationObservations) reset(symbol string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.m, symbol)
+}
@@ -0,0 +1,290 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/NuttapolCha/test-band-data-feeder/app/pricing"
+	"github.com/NuttapolCha/test-band-data-feeder/log"
+)
+
+// Decision tells why a symbol was or was not updated to destination.
+type Decision string
+
+const (
+	// DecisionFirstSeen symbol has no previous pricing in cache
+	DecisionFirstSeen Decision = "first-seen"
+	// DecisionStale destination has not been updated longer than the maximum delay
+	DecisionStale Decision = "stale"
+	// DecisionDeviation price differs from destination more than the threshold, updated immediatly
+	DecisionDeviation Decision = "deviation"
+	// DecisionSkip no need to update destination
+	DecisionSkip Decision = "skip"
+	// DecisionRejected pricing result is invalid or missing from data source
+	DecisionRejected Decision = "rejected"
+)
+
+// RecheckResult is the result of comparing destination pricing with what we have posted.
+type RecheckResult string
+
+const (
+	RecheckConfirmed RecheckResult = "confirmed"
+	RecheckMismatch  RecheckResult = "mismatch"
+	RecheckFailed    RecheckResult = "failed"
+)
+
+// SymbolReport is what happened to a symbol in a feeding cycle.
+type SymbolReport struct {
+	Symbol       string         `json:"symbol"`
+	FetchedPrice *pricing.Price `json:"fetched_price,omitempty"`
+	ResolveTime  int64          `json:"resolve_time,omitempty"`
+	Decision     Decision       `json:"decision"`
+	Reason       string         `json:"reason,omitempty"`
+
+	// DiffRatio is the observed deviation from the latest destination price, if known
+	DiffRatio *float64 `json:"diff_ratio,omitempty"`
+
+	// PostedGroup is the timestamp of the update request the symbol was posted in
+	PostedGroup int64          `json:"posted_group,omitempty"`
+	PostedPrice *pricing.Price `json:"posted_price,omitempty"`
+	Updated     bool           `json:"updated"`
+
+	Recheck  RecheckResult  `json:"recheck,omitempty"`
+	DstPrice *pricing.Price `json:"destination_price,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// FeedReport is what happened in a feeding cycle.
+type FeedReport struct {
+	CycleID         string          `json:"cycle_id"`
+	StartedAt       time.Time       `json:"started_at"`
+	FinishedAt      time.Time       `json:"finished_at"`
+	SourceRequestID int             `json:"source_request_id,omitempty"`
+	Symbols         []*SymbolReport `json:"symbols"`
+
+	// Errors failing the whole cycle, per symbol errors are in Symbols
+	Errors []string `json:"errors,omitempty"`
+
+	bySymbol map[string]*SymbolReport
+}
+
+func newFeedReport(startedAt time.Time) *FeedReport {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+
+	return &FeedReport{
+		CycleID:   fmt.Sprintf("%s-%s", startedAt.UTC().Format("20060102T150405"), hex.EncodeToString(suffix)),
+		StartedAt: startedAt,
+		Symbols:   make([]*SymbolReport, 0),
+		bySymbol:  make(map[string]*SymbolReport),
+	}
+}
+
+// symbol returns report of symbol, creating it if not exists.
+func (r *FeedReport) symbol(symbol string) *SymbolReport {
+	if s, ok := r.bySymbol[symbol]; ok {
+		return s
+	}
+	s := &SymbolReport{Symbol: symbol}
+	r.bySymbol[symbol] = s
+	r.Symbols = append(r.Symbols, s)
+	return s
+}
+
+func (r *FeedReport) addError(format string, args ...interface{}) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+// addOutcome records posted groups, failures and rechecks of an update.
+func (r *FeedReport) addOutcome(outcome *updateOutcome) {
+	for _, group := range outcome.groups {
+		for i, symbol := range group.params.Symbols {
+			s := r.symbol(symbol)
+			price := group.params.Prices[i]
+			s.PostedGroup = group.params.Timestamp
+			s.PostedPrice = &price
+			s.Updated = group.err == nil
+			if group.err != nil {
+				s.Error = group.err.Error()
+			}
+		}
+	}
+	for symbol, recheck := range outcome.rechecks {
+		s := r.symbol(symbol)
+		switch {
+		case recheck.err != nil:
+			s.Recheck = RecheckFailed
+			s.Error = recheck.err.Error()
+		case recheck.confirmed:
+			s.Recheck = RecheckConfirmed
+		default:
+			s.Recheck = RecheckMismatch
+		}
+		if recheck.err == nil {
+			dstPrice := recheck.dstPrice
+			s.DstPrice = &dstPrice
+		}
+	}
+}
+
+// Failed tells whether the cycle could not be done at all.
+func (r *FeedReport) Failed() bool {
+	return len(r.Errors) > 0
+}
+
+// Count returns number of symbols matching f.
+func (r *FeedReport) Count(f func(s *SymbolReport) bool) int {
+	n := 0
+	for _, s := range r.Symbols {
+		if f(s) {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *FeedReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteTable writes the report as a human readable table.
+func (r *FeedReport) WriteTable(w io.Writer) error {
+	fmt.Fprintf(w, "cycle: %s request: %d started: %s took: %v\n",
+		r.CycleID, r.SourceRequestID, r.StartedAt.Format(time.RFC3339), r.FinishedAt.Sub(r.StartedAt))
+	for _, e := range r.Errors {
+		fmt.Fprintf(w, "error: %s\n", e)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SYMBOL\tFETCHED\tDECISION\tPOSTED GROUP\tPOSTED\tRECHECK\tREASON / ERROR")
+	for _, s := range r.Symbols {
+		postedGroup := "-"
+		if s.PostedGroup != 0 {
+			postedGroup = fmt.Sprint(s.PostedGroup)
+		}
+		recheck := "-"
+		if s.Recheck != "" {
+			recheck = string(s.Recheck)
+		}
+		note := s.Reason
+		if s.Error != "" {
+			note = s.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			s.Symbol, optionalPrice(s.FetchedPrice), s.Decision, postedGroup, optionalPrice(s.PostedPrice), recheck, note)
+	}
+	return tw.Flush()
+}
+
+func optionalPrice(p *pricing.Price) string {
+	if p == nil {
+		return "-"
+	}
+	return p.String()
+}
+
+// ReportSink receives report of every feeding cycle, e.g. logs, metrics and audit trail.
+type ReportSink interface {
+	HandleReport(report *FeedReport)
+}
+
+// AddReportSink registers sink to receive report of every feeding cycle.
+func (app *App) AddReportSink(sink ReportSink) {
+	app.sinksMu.Lock()
+	defer app.sinksMu.Unlock()
+	app.reportSinks = append(app.reportSinks, sink)
+}
+
+// removeReportSink stops sink receiving reports, e.g. before it is closed.
+func (app *App) removeReportSink(sink ReportSink) {
+	app.sinksMu.Lock()
+	defer app.sinksMu.Unlock()
+	for i := range app.reportSinks {
+		if app.reportSinks[i] == sink {
+			app.reportSinks = append(app.reportSinks[:i:i], app.reportSinks[i+1:]...)
+			return
+		}
+	}
+}
+
+func (app *App) handleReport(report *FeedReport) {
+	app.sinksMu.Lock()
+	sinks := app.reportSinks
+	app.sinksMu.Unlock()
+
+	for _, sink := range sinks {
+		sink.HandleReport(report)
+	}
+}
+
+// logReportSink logs a one line summary of every cycle.
+type logReportSink struct {
+	logger log.Logger
+}
+
+func (s *logReportSink) HandleReport(r *FeedReport) {
+	logger := s.logger
+
+	updated := r.Count(func(s *SymbolReport) bool { return s.Updated })
+	failed := r.Count(func(s *SymbolReport) bool { return s.Error != "" })
+	if r.Failed() {
+		logger.Errorf("cycle %s failed after %v because: %v", r.CycleID, r.FinishedAt.Sub(r.StartedAt), r.Errors)
+		return
+	}
+	logger.Infof("cycle %s done in %v: %d symbols, %d updated, %d with errors",
+		r.CycleID, r.FinishedAt.Sub(r.StartedAt), len(r.Symbols), updated, failed)
+}
+
+// AuditFileSink appends every report as a JSON line to a file.
+type AuditFileSink struct {
+	logger log.Logger
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewAuditFileSink opens (or creates) the audit file at path for appending.
+func NewAuditFileSink(logger log.Logger, path string) (*AuditFileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditFileSink{
+		logger: logger,
+		f:      f,
+	}, nil
+}
+
+func (s *AuditFileSink) HandleReport(r *FeedReport) {
+	bs, err := json.Marshal(r)
+	if err != nil {
+		s.logger.Errorf("could not marshal report of cycle %s because: %v", r.CycleID, err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.f.Write(append(bs, '\n')); err != nil {
+		s.logger.Errorf("could not write report of cycle %s to %s because: %v", r.CycleID, s.f.Name(), err)
+	}
+}
+
+func (s *AuditFileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"context"
+)
+
+// bootstrapCache prepares the cache before the first feeding.
+// It restores the persisted latest pricing (if configured) and then warms
+// the cache up with what is actually on the destination, so the first decisions
+// are made against the destination rather than an empty cache.
+func (app *App) bootstrapCache(ctx context.Context, config *FeederConfig) {
+	app.restoreCache(config)
+
+	// warming up is bounded like a feeding cycle, so an unreachable destination cannot hold the feeder back
+	warmCtx, cancel := context.WithTimeout(ctx, app.getTimeConfig().cycleTimeout)
+	defer cancel()
+	app.warmCacheFromDst(warmCtx, config)
+
+	app.health.markBootstrapped()
+}
+
+// restoreCache loads the persisted latest pricing into cache if cache file is configured.
+// Failing to restore is not fatal, the feeder will behave like the cache is empty.
+func (app *App) restoreCache(config *FeederConfig) {
+	logger := app.logger
+
+	if config.cacheFilePath == "" {
+		logger.Warnf("cache file path is not configured, latest pricing will not survive restarting")
+		return
+	}
+
+	n, err := app.cache.Restore(config.cacheFilePath)
+	if err != nil {
+		logger.Errorf("could not restore cache from %s because: %v", config.cacheFilePath, err)
+		return
+	}
+	logger.Infof("restored latest pricing of %d symbols from %s", n, config.cacheFilePath)
+}
+
+// warmCacheFromDst seeds the cache with the latest pricing of every configured symbol at destination.
+// The local cache is kept if it is as new as the destination.
+func (app *App) warmCacheFromDst(ctx context.Context, config *FeederConfig) {
+	logger := app.logger
+
+	warmed := make([]string, 0, len(config.symbols))
+	for _, symbol := range config.symbols {
+		if ctx.Err() != nil {
+			logger.Warnf("BOOTSTRAP: stop warming cache up because: %v", ctx.Err())
+			break
+		}
+		dstPricing, err := app.getPricingFromDst(ctx, symbol, config)
+		if err != nil {
+			logger.Warnf("BOOTSTRAP: could not get pricing of %s from destination because: %v", symbol, err)
+			continue
+		}
+		if dstPricing.GetTimestamp() <= 0 {
+			logger.Infof("BOOTSTRAP: destination has no pricing of %s yet", symbol)
+			continue
+		}
+
+		if cached, err := app.cache.GetPricing(symbol); err == nil && cached.GetTimestamp() >= dstPricing.GetTimestamp() {
+			logger.Debugf("BOOTSTRAP: cached pricing of %s is as new as destination, keep it", symbol)
+			continue
+		}
+
+		// we do not know when destination was actually updated,
+		// the pricing timestamp is the best estimation of it
+		if err := app.cache.UpdatePricing(
+			symbol,
+			dstPricing.GetPrice(),
+			dstPricing.GetTimestamp(),
+			dstPricing.GetTimestamp(),
+		); err != nil {
+			logger.Errorf("BOOTSTRAP: could not persist cache information of %s because: %v", symbol, err)
+		}
+		warmed = append(warmed, symbol)
+	}
+
+	logger.Infof("BOOTSTRAP: warmed cache up from destination for symbols %+v", warmed)
+}
+
+func (app *App) closeCache() {
+	if err := app.cache.Close(); err != nil {
+		app.logger.Errorf("could not close cache file because: %v", err)
+	}
+}
@@ -1,80 +1,311 @@
 package app
 
 import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/NuttapolCha/test-band-data-feeder/connector"
 	"github.com/spf13/viper"
 )
 
 type FeederConfig struct {
-	// Symbols
-	symbols []string
+	// Symbols in configured order and their update policies
+	symbols        []string
+	symbolPolicies map[string]*SymbolPolicy
 
 	// Data Source
 	dataSourceRetryCount       int
+	dataSourceRetryPolicy      *connector.RetryPolicy
 	requestPricingDataEndpoint string
 	getPricingDataEndpoint     string
 
-	// wait time before get the requested pricing
-	waitTime time.Duration
+	// polling the requested pricing until it is resolved
+	pollInitialDelay time.Duration
+	pollInterval     time.Duration
+	pollDeadline     time.Duration
+
+	// pricing results resolved out of these bounds are rejected
+	maxClockSkew time.Duration
+	maxResultAge time.Duration
 
 	// Update Destination
 	destinationRetryCount     int
+	destinationRetryPolicy    *connector.RetryPolicy
+	destinationConcurrency    int
 	updatePricingDataEndpoint string
 	getUpdatedPricingData     string
-	maximumDelay              int64
-	diffThreshold             float64
 	enableRecheck             bool
+
+	// default policy of symbols not overriding it
+	defaultSymbolPolicy SymbolPolicy
+
+	// Cache
+	cacheFilePath string
+
+	// report of every feeding is appended here if not empty
+	auditFilePath string
 }
 
-var feederConfig *FeederConfig
-
-func getFeederConfig() *FeederConfig {
-	if feederConfig == nil {
-		feederConfig = &FeederConfig{
-			symbols:                    viper.GetStringSlice("DataFeeder.Symbols"),
-			waitTime:                   viper.GetDuration("DataFeeder.WaitTime") * time.Second,
-			dataSourceRetryCount:       viper.GetInt("ExternalAPIs.DataSource.RetryCount"),
-			requestPricingDataEndpoint: viper.GetString("ExternalAPIs.DataSource.RequestPricingData"),
-			getPricingDataEndpoint:     viper.GetString("ExternalAPIs.DataSource.GetPricingData"),
-			destinationRetryCount:      viper.GetInt("ExternalAPIs.Destination.RetryCount"),
-			updatePricingDataEndpoint:  viper.GetString("ExternalAPIs.Destination.UpdatePricingData"),
-			getUpdatedPricingData:      viper.GetString("ExternalAPIs.Destination.GetUpdatedPricingData"),
-			maximumDelay:               viper.GetInt64("DataFeeder.MaximumDelay"),
-			diffThreshold:              viper.GetFloat64("DataFeeder.DiffThreshold"),
-			enableRecheck:              viper.GetBool("DataFeeder.EnableRecheck"),
-		}
-		if feederConfig.symbols == nil {
-			feederConfig.symbols = []string{"BTC", "ETH"}
-		}
-		if feederConfig.waitTime == 0 {
-			feederConfig.waitTime = 5 * time.Second
-		}
-		if feederConfig.dataSourceRetryCount == 0 {
-			feederConfig.dataSourceRetryCount = 1
-		}
-		if feederConfig.requestPricingDataEndpoint == "" {
-			feederConfig.requestPricingDataEndpoint = "https://interview-requester-source.herokuapp.com/request"
+// getFeederConfig returns the current feeder config, it is swapped as a whole on reload.
+func (app *App) getFeederConfig() *FeederConfig {
+	return app.feederConfig.Load().(*FeederConfig)
+}
+
+// loadFeederConfig reads and validates feeder config from v.
+func loadFeederConfig(v *viper.Viper) (*FeederConfig, error) {
+	config, err := readFeederConfig(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// readFeederConfig reads feeder config from v with defaults applied. The config is returned
+// even if symbols cannot be parsed, so that the rest of it can still be shown.
+func readFeederConfig(v *viper.Viper) (*FeederConfig, error) {
+	config := &FeederConfig{
+		pollInitialDelay:           getSeconds(v, "DataFeeder.PollInitialDelay"),
+		pollInterval:               getSeconds(v, "DataFeeder.PollInterval"),
+		pollDeadline:               getSeconds(v, "DataFeeder.PollDeadline"),
+		maxClockSkew:               getSeconds(v, "DataFeeder.Validation.MaxClockSkew"),
+		maxResultAge:               getSeconds(v, "DataFeeder.Validation.MaxResultAge"),
+		dataSourceRetryCount:       v.GetInt("ExternalAPIs.DataSource.RetryCount"),
+		requestPricingDataEndpoint: v.GetString("ExternalAPIs.DataSource.RequestPricingData"),
+		getPricingDataEndpoint:     v.GetString("ExternalAPIs.DataSource.GetPricingData"),
+		destinationRetryCount:      v.GetInt("ExternalAPIs.Destination.RetryCount"),
+		destinationConcurrency:     v.GetInt("ExternalAPIs.Destination.Concurrency"),
+		updatePricingDataEndpoint:  v.GetString("ExternalAPIs.Destination.UpdatePricingData"),
+		getUpdatedPricingData:      v.GetString("ExternalAPIs.Destination.GetUpdatedPricingData"),
+		enableRecheck:              v.GetBool("DataFeeder.EnableRecheck"),
+		defaultSymbolPolicy: SymbolPolicy{
+			maximumDelay:      v.GetInt64("DataFeeder.MaximumDelay"),
+			diffThreshold:     v.GetFloat64("DataFeeder.DiffThreshold"),
+			minUpdateInterval: v.GetInt64("DataFeeder.MinUpdateInterval"),
+			confirmationCount: v.GetInt("DataFeeder.ConfirmationCount"),
+			pricePrecision:    v.GetInt("DataFeeder.PricePrecision"),
+		},
+		cacheFilePath: v.GetString("Cache.FilePath"),
+		auditFilePath: v.GetString("Audit.FilePath"),
+	}
+	if config.pollInitialDelay == 0 {
+		// WaitTime is deprecated, it was a fixed delay before getting the requested pricing
+		config.pollInitialDelay = getSeconds(v, "DataFeeder.WaitTime")
+	}
+	if config.pollInitialDelay == 0 {
+		config.pollInitialDelay = 1 * time.Second
+	}
+	if config.pollInterval == 0 {
+		config.pollInterval = 1 * time.Second
+	}
+	if config.pollDeadline == 0 {
+		config.pollDeadline = 5 * time.Second
+	}
+	if config.dataSourceRetryCount == 0 {
+		config.dataSourceRetryCount = 1
+	}
+	if config.requestPricingDataEndpoint == "" {
+		config.requestPricingDataEndpoint = "https://interview-requester-source.herokuapp.com/request"
+	}
+	if config.getPricingDataEndpoint == "" {
+		config.getPricingDataEndpoint = "https://interview-requester-source.herokuapp.com/request"
+	}
+	if config.destinationRetryCount == 0 {
+		config.destinationRetryCount = 1
+	}
+	if config.destinationConcurrency == 0 {
+		config.destinationConcurrency = 4
+	}
+	if config.updatePricingDataEndpoint == "" {
+		config.updatePricingDataEndpoint = "https://band-interview-destination.herokuapp.com/update"
+	}
+	if config.getUpdatedPricingData == "" {
+		config.getUpdatedPricingData = "https://band-interview-destination.herokuapp.com/get_price"
+	}
+	if config.defaultSymbolPolicy.maximumDelay == 0 {
+		config.defaultSymbolPolicy.maximumDelay = 3600
+	}
+	if config.defaultSymbolPolicy.diffThreshold == 0 {
+		config.defaultSymbolPolicy.diffThreshold = 0.1
+	}
+	if config.defaultSymbolPolicy.confirmationCount == 0 {
+		config.defaultSymbolPolicy.confirmationCount = 1
+	}
+	// zero decimal places is a valid precision
+	if !v.IsSet("DataFeeder.PricePrecision") {
+		config.defaultSymbolPolicy.pricePrecision = 8
+	}
+	if config.maxClockSkew == 0 {
+		config.maxClockSkew = 60 * time.Second
+	}
+	if config.maxResultAge == 0 {
+		config.maxResultAge = 300 * time.Second
+	}
+
+	config.dataSourceRetryPolicy = getRetryPolicy(v, "ExternalAPIs.DataSource", config.dataSourceRetryCount)
+	config.destinationRetryPolicy = getRetryPolicy(v, "ExternalAPIs.Destination", config.destinationRetryCount)
+
+	// the global values are defaults of every symbol
+	config.symbolPolicies = make(map[string]*SymbolPolicy)
+	policies, err := parseSymbolPolicies(v.Get("DataFeeder.Symbols"), config.defaultSymbolPolicy)
+	if err != nil {
+		return config, fmt.Errorf("invalid DataFeeder.Symbols: %w", err)
+	}
+	if len(policies) == 0 {
+		policies, _ = parseSymbolPolicies([]string{"BTC", "ETH"}, config.defaultSymbolPolicy)
+	}
+	for _, policy := range policies {
+		config.symbols = append(config.symbols, policy.symbol)
+		config.symbolPolicies[policy.symbol] = policy
+	}
+	return config, nil
+}
+
+// validate rejects values the feeder cannot work with.
+func (c *FeederConfig) validate() error {
+	endpoints := map[string]string{
+		"ExternalAPIs.DataSource.RequestPricingData":     c.requestPricingDataEndpoint,
+		"ExternalAPIs.DataSource.GetPricingData":         c.getPricingDataEndpoint,
+		"ExternalAPIs.Destination.UpdatePricingData":     c.updatePricingDataEndpoint,
+		"ExternalAPIs.Destination.GetUpdatedPricingData": c.getUpdatedPricingData,
+	}
+	for key, endpoint := range endpoints {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
 		}
-		if feederConfig.getPricingDataEndpoint == "" {
-			feederConfig.getPricingDataEndpoint = "https://interview-requester-source.herokuapp.com/request"
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid %s: %q is not an absolute http(s) URL", key, endpoint)
 		}
-		if feederConfig.destinationRetryCount == 0 {
-			feederConfig.destinationRetryCount = 1
+	}
+
+	durations := map[string]time.Duration{
+		"DataFeeder.PollInitialDelay":        c.pollInitialDelay,
+		"DataFeeder.PollInterval":            c.pollInterval,
+		"DataFeeder.PollDeadline":            c.pollDeadline,
+		"DataFeeder.Validation.MaxClockSkew": c.maxClockSkew,
+		"DataFeeder.Validation.MaxResultAge": c.maxResultAge,
+	}
+	for key, d := range durations {
+		if d <= 0 {
+			return fmt.Errorf("invalid %s: must be positive but got %v", key, d)
 		}
-		if feederConfig.updatePricingDataEndpoint == "" {
-			feederConfig.updatePricingDataEndpoint = "https://band-interview-destination.herokuapp.com/update"
+	}
+
+	if c.dataSourceRetryCount < 1 {
+		return fmt.Errorf("invalid ExternalAPIs.DataSource.RetryCount: must be at least 1 but got %d", c.dataSourceRetryCount)
+	}
+	if c.destinationRetryCount < 1 {
+		return fmt.Errorf("invalid ExternalAPIs.Destination.RetryCount: must be at least 1 but got %d", c.destinationRetryCount)
+	}
+	if c.destinationConcurrency < 1 {
+		return fmt.Errorf("invalid ExternalAPIs.Destination.Concurrency: must be at least 1 but got %d", c.destinationConcurrency)
+	}
+
+	for _, symbol := range c.symbols {
+		if err := c.symbolPolicies[symbol].validate(); err != nil {
+			return fmt.Errorf("invalid DataFeeder.Symbols: %s: %w", symbol, err)
 		}
-		if feederConfig.getUpdatedPricingData == "" {
-			feederConfig.getUpdatedPricingData = "https://band-interview-destination.herokuapp.com/get_price"
+	}
+	return nil
+}
+
+// describe flattens config into printable values keyed by their config keys,
+// so that two configs can be compared.
+func (c *FeederConfig) describe() map[string]string {
+	d := map[string]string{
+		"DataFeeder.Symbols":                             strings.Join(c.symbols, ","),
+		"DataFeeder.PollInitialDelay":                    c.pollInitialDelay.String(),
+		"DataFeeder.PollInterval":                        c.pollInterval.String(),
+		"DataFeeder.PollDeadline":                        c.pollDeadline.String(),
+		"DataFeeder.Validation.MaxClockSkew":             c.maxClockSkew.String(),
+		"DataFeeder.Validation.MaxResultAge":             c.maxResultAge.String(),
+		"DataFeeder.EnableRecheck":                       fmt.Sprint(c.enableRecheck),
+		"ExternalAPIs.DataSource.RequestPricingData":     c.requestPricingDataEndpoint,
+		"ExternalAPIs.DataSource.GetPricingData":         c.getPricingDataEndpoint,
+		"ExternalAPIs.Destination.UpdatePricingData":     c.updatePricingDataEndpoint,
+		"ExternalAPIs.Destination.GetUpdatedPricingData": c.getUpdatedPricingData,
+		"ExternalAPIs.Destination.Concurrency":           fmt.Sprint(c.destinationConcurrency),
+		"Cache.FilePath":                                 c.cacheFilePath,
+		"Audit.FilePath":                                 c.auditFilePath,
+	}
+	describeRetry(d, "ExternalAPIs.DataSource", c.dataSourceRetryCount, c.dataSourceRetryPolicy)
+	describeRetry(d, "ExternalAPIs.Destination", c.destinationRetryCount, c.destinationRetryPolicy)
+	for key, val := range c.defaultSymbolPolicy.describe() {
+		d["DataFeeder."+key] = val
+	}
+	for symbol, policy := range c.symbolPolicies {
+		for key, val := range policy.describe() {
+			d[fmt.Sprintf("DataFeeder.Symbols[%s].%s", symbol, key)] = val
 		}
-		if feederConfig.maximumDelay == 0 {
-			feederConfig.maximumDelay = 3600
+	}
+	return d
+}
+
+func describeRetry(d map[string]string, key string, retryCount int, policy *connector.RetryPolicy) {
+	d[key+".RetryCount"] = fmt.Sprint(retryCount)
+	d[key+".Retry.BaseDelay"] = policy.BaseDelay.String()
+	d[key+".Retry.MaxDelay"] = policy.MaxDelay.String()
+	d[key+".Retry.Jitter"] = fmt.Sprint(policy.Jitter)
+	d[key+".Retry.RetryableStatusCodes"] = fmt.Sprint(policy.RetryableStatusCodes)
+}
+
+// diffDescriptions lists what has changed from old to new, sorted by key.
+func diffDescriptions(old, new map[string]string) []string {
+	keys := make([]string, 0, len(new))
+	for key := range old {
+		keys = append(keys, key)
+	}
+	for key := range new {
+		if _, ok := old[key]; !ok {
+			keys = append(keys, key)
 		}
-		if feederConfig.diffThreshold == 0 {
-			feederConfig.diffThreshold = 0.1
+	}
+	sort.Strings(keys)
+
+	changes := make([]string, 0)
+	for _, key := range keys {
+		oldVal, hadOld := old[key]
+		newVal, hasNew := new[key]
+		switch {
+		case !hadOld:
+			changes = append(changes, fmt.Sprintf("%s: added %q", key, newVal))
+		case !hasNew:
+			changes = append(changes, fmt.Sprintf("%s: removed %q", key, oldVal))
+		case oldVal != newVal:
+			changes = append(changes, fmt.Sprintf("%s: %q -> %q", key, oldVal, newVal))
 		}
+	}
+	return changes
+}
 
+// policyOf returns update policy of symbol, unknown symbols get the default policy.
+func (c *FeederConfig) policyOf(symbol string) *SymbolPolicy {
+	if policy, ok := c.symbolPolicies[symbol]; ok {
+		return policy
 	}
-	return feederConfig
+	policy := c.defaultSymbolPolicy
+	policy.symbol = symbol
+	return &policy
+}
+
+// getRetryPolicy reads retry policy of the endpoint group at key, delays are in seconds.
+func getRetryPolicy(v *viper.Viper, key string, retryCount int) *connector.RetryPolicy {
+	return connector.NewRetryPolicy(
+		retryCount,
+		getSeconds(v, key+".Retry.BaseDelay"),
+		getSeconds(v, key+".Retry.MaxDelay"),
+		v.GetFloat64(key+".Retry.Jitter"),
+		v.GetIntSlice(key+".Retry.RetryableStatusCodes"),
+	)
+}
+
+// getSeconds reads key as a number of seconds, fractions of a second are kept.
+func getSeconds(v *viper.Viper, key string) time.Duration {
+	return time.Duration(v.GetFloat64(key) * float64(time.Second))
 }
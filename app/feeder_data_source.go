@@ -1,11 +1,24 @@
 package app
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NuttapolCha/test-band-data-feeder/app/pricing"
+	"github.com/NuttapolCha/test-band-data-feeder/clock"
+	"github.com/NuttapolCha/test-band-data-feeder/connector"
+	"github.com/NuttapolCha/test-band-data-feeder/log"
 )
 
+// errPricingNotResolved is returned when the requested pricing is not ready at data source yet
+var errPricingNotResolved = errors.New("requested pricing has not been resolved yet")
+
 type RequestPricingDataSourceParams struct {
 	Symbols []string `json:"symbols"`
 }
@@ -20,38 +33,73 @@ type PricingResult struct {
 	RequestID   string `json:"request_id"`
 	ResolveTime string `json:"resolve_time"`
 	Symbol      string `json:"symbol"`
-}
 
-func (p *PricingResult) GetSymbol() string {
-	return p.Symbol
+	// parsed by validatePricingResults, see parse
+	parsed    bool
+	price     pricing.Price
+	timestamp int64
 }
 
-func (p *PricingResult) GetPrice() float64 {
-	multipliedPrice, err := strconv.ParseFloat(p.Px, 64)
+// parse parses px, multiplier and resolve_time so the result can be used as pricing.Information.
+func (p *PricingResult) parse() error {
+	price, err := pricing.NewPriceFromMultiplied(p.Px, p.Multiplier)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	multiplier, err := strconv.ParseFloat(p.Multiplier, 64)
+	t, err := strconv.ParseInt(p.ResolveTime, 10, 64)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("invalid resolve_time %q", p.ResolveTime)
 	}
-	return multipliedPrice / multiplier
+	p.price = price
+	p.timestamp = t
+	p.parsed = true
+	return nil
 }
 
-func (p *PricingResult) GetTimestamp() int64 {
-	t, err := strconv.ParseInt(p.ResolveTime, 10, 64)
-	if err != nil {
-		panic(err)
+// mustBeParsed panics on using a result which has not been validated,
+// its zero price and timestamp would otherwise be fed silently.
+func (p *PricingResult) mustBeParsed() {
+	if !p.parsed {
+		panic(fmt.Sprintf("pricing result of %s has not been validated", p.Symbol))
 	}
-	return t
+}
+
+func (p *PricingResult) GetSymbol() string {
+	return p.Symbol
+}
+
+// GetPrice returns px / multiplier, the result must have been validated.
+func (p *PricingResult) GetPrice() pricing.Price {
+	p.mustBeParsed()
+	return p.price
+}
+
+// GetTimestamp returns resolve_time, the result must have been validated.
+func (p *PricingResult) GetTimestamp() int64 {
+	p.mustBeParsed()
+	return p.timestamp
 }
 
 type PricingResultResp struct {
 	PricingResults []*PricingResult `json:"price_results"`
+	Status         string           `json:"status,omitempty"`
+}
+
+func (r *PricingResultResp) isPending() bool {
+	switch strings.ToLower(r.Status) {
+	case "pending", "processing", "waiting":
+		return true
+	}
+	return len(r.PricingResults) == 0
 }
 
-func (app *App) requestPricingFromSource(config *FeederConfig) (int, error) {
-	logger := app.logger
+func (app *App) requestPricingFromSource(ctx context.Context, config *FeederConfig) (reqId int, err error) {
+	logger := log.FromContext(ctx, app.logger)
+
+	start := time.Now()
+	defer func() {
+		observeSourceRequest("request", start, err)
+	}()
 
 	bs, err := json.Marshal(&RequestPricingDataSourceParams{
 		Symbols: config.symbols,
@@ -61,7 +109,7 @@ func (app *App) requestPricingFromSource(config *FeederConfig) (int, error) {
 		return -1, err
 	}
 
-	respBody, err := app.httpClient.PostJSON(config.requestPricingDataEndpoint, bs, config.dataSourceRetryCount)
+	respBody, err := app.httpClient.PostJSON(ctx, config.requestPricingDataEndpoint, bs, config.dataSourceRetryPolicy)
 	if err != nil {
 		logger.Errorf("could not PostJSON because: %v", err)
 		return -1, err
@@ -75,12 +123,18 @@ func (app *App) requestPricingFromSource(config *FeederConfig) (int, error) {
 	return ref.ID, nil
 }
 
-func (app *App) getRequestedPricingFromSource(reqId int, config *FeederConfig) ([]*PricingResult, error) {
-	logger := app.logger
+func (app *App) getRequestedPricingFromSource(ctx context.Context, reqId int, config *FeederConfig) ([]*PricingResult, error) {
+	logger := log.FromContext(ctx, app.logger)
 
 	pricingEndpoint := fmt.Sprintf("%s/%d", config.getPricingDataEndpoint, reqId)
-	respBody, err := app.httpClient.Get(pricingEndpoint, nil, config.dataSourceRetryCount)
+	// data source responds 404 until the requested pricing is resolved
+	policy := config.dataSourceRetryPolicy.Expecting(http.StatusNotFound)
+	respBody, err := app.httpClient.Get(ctx, pricingEndpoint, nil, policy)
 	if err != nil {
+		var statusErr *connector.StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+			return nil, errPricingNotResolved
+		}
 		logger.Errorf("could not get the requested pricing data from source because: %v", err)
 		return nil, err
 	}
@@ -90,6 +144,49 @@ func (app *App) getRequestedPricingFromSource(reqId int, config *FeederConfig) (
 		logger.Errorf("could not unmarshal pricing result into GO struct because: %v", err)
 		return nil, err
 	}
+	if pricingResp.isPending() {
+		return nil, errPricingNotResolved
+	}
 
 	return pricingResp.PricingResults, nil
 }
+
+// pollRequestedPricingFromSource gets the requested pricing from data source repeatedly
+// until it is resolved or the polling deadline is reached.
+func (app *App) pollRequestedPricingFromSource(ctx context.Context, reqId int, config *FeederConfig) (pricingResults []*PricingResult, err error) {
+	logger := log.FromContext(ctx, app.logger)
+
+	start := time.Now()
+	defer func() {
+		observeSourceRequest("poll", start, err)
+	}()
+	ctx, cancel := context.WithTimeout(ctx, config.pollDeadline)
+	defer cancel()
+
+	// polling is scheduled on the feeder clock, the context bounds it in real time as well
+	polledAt := app.clock.Now()
+	deadline := polledAt.Add(config.pollDeadline)
+
+	if err := clock.Sleep(ctx, app.clock, config.pollInitialDelay); err != nil {
+		return nil, fmt.Errorf("stop polling requested pricing %d because: %w", reqId, err)
+	}
+
+	for polls := 1; ; polls++ {
+		pricingResults, err := app.getRequestedPricingFromSource(ctx, reqId, config)
+		if err == nil {
+			logger.Debugf("requested pricing %d resolved after %d polls, time used: %v", reqId, polls, app.clock.Now().Sub(polledAt))
+			return pricingResults, nil
+		}
+		if !errors.Is(err, errPricingNotResolved) {
+			return nil, err
+		}
+
+		if app.clock.Now().Add(config.pollInterval).After(deadline) {
+			return nil, fmt.Errorf("requested pricing %d has not been resolved within %v after %d polls", reqId, config.pollDeadline, polls)
+		}
+		logger.Debugf("poll: %d requested pricing %d has not been resolved yet, will poll again in %v", polls, reqId, config.pollInterval)
+		if err := clock.Sleep(ctx, app.clock, config.pollInterval); err != nil {
+			return nil, fmt.Errorf("stop polling requested pricing %d after %d polls because: %w", reqId, polls, err)
+		}
+	}
+}
@@ -1,23 +1,25 @@
 package app
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/NuttapolCha/test-band-data-feeder/app/pricing"
-	"github.com/NuttapolCha/test-band-data-feeder/cache"
+	"github.com/NuttapolCha/test-band-data-feeder/log"
 )
 
 type UpdatePricingParams struct {
-	Symbols   []string  `json:"symbols"`
-	Prices    []float64 `json:"prices"`
-	Timestamp int64     `json:"timestamp"`
+	Symbols   []string        `json:"symbols"`
+	Prices    []pricing.Price `json:"prices"`
+	Timestamp int64           `json:"timestamp"`
 }
 
 type DestinationPricingResp struct {
-	Price      float64 `json:"price"`
-	LastUpdate int64   `json:"last_update"`
+	Price      pricing.Price `json:"price"`
+	LastUpdate int64         `json:"last_update"`
 
 	symbol string `json:"-"`
 }
@@ -26,7 +28,7 @@ func (p *DestinationPricingResp) GetSymbol() string {
 	return p.symbol
 }
 
-func (p *DestinationPricingResp) GetPrice() float64 {
+func (p *DestinationPricingResp) GetPrice() pricing.Price {
 	return p.Price
 }
 
@@ -34,12 +36,12 @@ func (p *DestinationPricingResp) GetTimestamp() int64 {
 	return p.LastUpdate
 }
 
-func (app *App) getPricingFromDst(symbol string, config *FeederConfig) (*DestinationPricingResp, error) {
-	logger := app.logger
+func (app *App) getPricingFromDst(ctx context.Context, symbol string, config *FeederConfig) (*DestinationPricingResp, error) {
+	logger := log.FromContext(ctx, app.logger).With(log.Symbol(symbol))
 
-	body, err := app.httpClient.Get(config.getUpdatedPricingData, map[string]string{
+	body, err := app.httpClient.Get(ctx, config.getUpdatedPricingData, map[string]string{
 		"symbol": symbol,
-	}, config.destinationRetryCount)
+	}, config.destinationRetryPolicy)
 	if err != nil {
 		logger.Errorf("could not http GET because: %v", err)
 		return nil, err
@@ -55,17 +57,27 @@ func (app *App) getPricingFromDst(symbol string, config *FeederConfig) (*Destina
 	return ret, nil
 }
 
+// updateDecision tells whether and why a symbol needs to be updated to destination
+type updateDecision struct {
+	decision  Decision
+	reason    string
+	diffRatio *pricing.Price
+}
+
 // need update pricing criterias are
-// 1. no new update than 1 hour (configurable)
-// 2. price difference is more than threshold 0.1 (configurable)
+// 1. no new update than 1 hour (configurable per symbol)
+// 2. price difference is more than threshold 0.1 (configurable per symbol)
+// the price difference must be observed in consecutive feedings (configurable per symbol)
+// and is not sent if destination has been updated within the minimum update interval of the symbol
 func (app *App) isNeedUpdatePricingToDestination(
+	ctx context.Context,
 	prevUpdateDstTime int64,
 	prevPricing,
 	currPricing pricing.Information,
 	config *FeederConfig,
-) (is, immediatly bool) {
-	logger := app.logger
+) *updateDecision {
 	symbol := prevPricing.GetSymbol()
+	logger := log.FromContext(ctx, app.logger).With(log.Symbol(symbol))
 
 	// optional: checking if prevPricing and currPricing are the same symbol
 	if symbol != currPricing.GetSymbol() {
@@ -73,130 +85,247 @@ func (app *App) isNeedUpdatePricingToDestination(
 		panic(errMsg)
 	}
 
-	currTime := time.Now().Unix()
+	currTime := app.clock.Now().Unix()
 	timeDiff := currTime - prevUpdateDstTime
 	logger.Debugf("previous cache time of %s = %v", symbol, prevUpdateDstTime)
 	logger.Debugf("current time = %v", currTime)
 	logger.Debugf("time diff of %s = %v", symbol, time.Duration(timeDiff)*time.Second)
 
-	if timeDiff >= config.maximumDelay {
-		logger.Infof("RELAY: symbol %s has not send update longer than %vs and need to be updated", symbol, config.maximumDelay)
-		return true, false
+	policy := config.policyOf(symbol)
+	if timeDiff >= policy.maximumDelay {
+		logger.Infof("RELAY: symbol %s has not send update longer than %vs and need to be updated", symbol, policy.maximumDelay)
+		return &updateDecision{
+			decision: DecisionStale,
+			reason:   fmt.Sprintf("not updated for %v, longer than %vs", time.Duration(timeDiff)*time.Second, policy.maximumDelay),
+		}
 	}
 
 	prevPrice := prevPricing.GetPrice()
 	currPrice := currPricing.GetPrice()
-	logger.Debugf("previous price of %s = %f", symbol, prevPrice)
-	logger.Debugf("current price of %s = %f", symbol, currPrice)
+	logger.Debugf("previous price of %s = %s", symbol, prevPrice)
+	logger.Debugf("current price of %s = %s", symbol, currPrice)
 
 	// use absolute value
-	priceDiffRatio := (currPrice - prevPrice) / currPrice
-	if priceDiffRatio < 0 {
-		priceDiffRatio *= -1
+	priceDiffRatio := currPrice.DiffRatio(prevPrice)
+	logger.Debugf("price diff ratio of %s = %.4f", symbol, priceDiffRatio.Float64())
+
+	skip := func(format string, args ...interface{}) *updateDecision {
+		return &updateDecision{
+			decision:  DecisionSkip,
+			reason:    fmt.Sprintf(format, args...),
+			diffRatio: &priceDiffRatio,
+		}
 	}
-	logger.Debugf("price diff ratio of %s = %.4f", symbol, priceDiffRatio)
 
-	if priceDiffRatio > config.diffThreshold {
-		logger.Infof("URGENT: symbol %s has difference grater than threshold %v and need to be updated immediatly", symbol, config.diffThreshold)
-		return true, true
+	if priceDiffRatio.Cmp(pricing.PriceFromFloat(policy.diffThreshold)) <= 0 {
+		app.observations.reset(symbol)
+		logger.Infof("symbol %s no need to send update at destination because delay = %v and diff ratio = %.4f", symbol, time.Duration(timeDiff)*time.Second, priceDiffRatio.Float64())
+		return skip("diff ratio %.4f is within threshold %v", priceDiffRatio.Float64(), policy.diffThreshold)
 	}
 
-	logger.Infof("symbol %s no need to send update at destination because delay = %v and diff ratio = %f", symbol, time.Duration(timeDiff)*time.Second, priceDiffRatio)
-	return false, false
+	// a flip across the threshold must persist before we react to it
+	observed := app.observations.observe(symbol)
+	if observed < policy.confirmationCount {
+		logger.Infof("symbol %s has difference grater than threshold %v, waiting for confirmation %d/%d", symbol, policy.diffThreshold, observed, policy.confirmationCount)
+		return skip("waiting for confirmation %d/%d", observed, policy.confirmationCount)
+	}
+
+	// bound the write rate to destination
+	if timeDiff < policy.minUpdateInterval {
+		logger.Infof("symbol %s has difference grater than threshold %v but was updated %v ago, less than minimum update interval %vs", symbol, policy.diffThreshold, time.Duration(timeDiff)*time.Second, policy.minUpdateInterval)
+		return skip("updated %v ago, less than minimum update interval %vs", time.Duration(timeDiff)*time.Second, policy.minUpdateInterval)
+	}
+
+	logger.Infof("URGENT: symbol %s has difference grater than threshold %v and need to be updated immediatly", symbol, policy.diffThreshold)
+	return &updateDecision{
+		decision:  DecisionDeviation,
+		reason:    fmt.Sprintf("diff ratio %.4f is grater than threshold %v", priceDiffRatio.Float64(), policy.diffThreshold),
+		diffRatio: &priceDiffRatio,
+	}
+}
+
+// groupOutcome is the result of posting one group of pricing sharing the same timestamp.
+type groupOutcome struct {
+	params *UpdatePricingParams
+	err    error
+}
+
+// recheckOutcome is the result of comparing destination pricing with what we have posted.
+type recheckOutcome struct {
+	symbol    string
+	confirmed bool
+	dstPrice  pricing.Price
+	err       error
 }
 
-func (app *App) updatePricingToDestination(symbolMapPricing map[string]pricing.Information, config *FeederConfig) ([]string, error) {
-	logger := app.logger
-	updatedSymbols := make([]string, 0, len(symbolMapPricing))
+// updateOutcome aggregates results of updatePricingToDestination.
+type updateOutcome struct {
+	groups         []*groupOutcome
+	updatedSymbols []string
+	failedSymbols  map[string]error
+
+	// rechecks is keyed by symbol, empty if recheck is disabled
+	rechecks map[string]*recheckOutcome
+}
+
+// updatePricingToDestination sends pricing of every symbol to destination grouped by timestamp.
+// Groups are posted concurrently, up to the destination concurrency, and then every updated
+// symbol is rechecked concurrently as well. Each symbol is posted before it is rechecked.
+func (app *App) updatePricingToDestination(
+	ctx context.Context,
+	symbolMapPricing map[string]pricing.Information,
+	config *FeederConfig,
+) *updateOutcome {
+	logger := log.FromContext(ctx, app.logger)
+	outcome := &updateOutcome{
+		updatedSymbols: make([]string, 0, len(symbolMapPricing)),
+		failedSymbols:  make(map[string]error),
+		rechecks:       make(map[string]*recheckOutcome),
+	}
+	if len(symbolMapPricing) == 0 {
+		return outcome
+	}
 
 	// endpoint required request body classified by timestamp
 	timestampMapPricingList := make(map[int64][]pricing.Information)
 
+	// prices are rounded to the output precision of each symbol,
+	// what we send is what we cache and recheck against
+	postedPrices := make(map[string]pricing.Price, len(symbolMapPricing))
+
 	for symbol, info := range symbolMapPricing {
 		timestampMapPricingList[info.GetTimestamp()] = append(
 			timestampMapPricingList[info.GetTimestamp()],
 			symbolMapPricing[symbol],
 		)
+		postedPrices[symbol] = info.GetPrice().Round(config.policyOf(symbol).pricePrecision)
+	}
+
+	// oldest timestamp first, so logs and payloads are deterministic
+	timestamps := make([]int64, 0, len(timestampMapPricingList))
+	for timestamp := range timestampMapPricingList {
+		timestamps = append(timestamps, timestamp)
 	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	for _, timestamp := range timestamps {
+		pricingList := timestampMapPricingList[timestamp]
+		sort.Slice(pricingList, func(i, j int) bool { return pricingList[i].GetSymbol() < pricingList[j].GetSymbol() })
 
-	updatePricingParamsList := make([]*UpdatePricingParams, 0)
-	for timestamp, pricingList := range timestampMapPricingList {
 		// we should classify data by timestamp first
 		toUpdatedSymbols := []string{}
-		toUpdatedPrices := []float64{}
+		toUpdatedPrices := []pricing.Price{}
 		for _, info := range pricingList {
 			toUpdatedSymbols = append(toUpdatedSymbols, info.GetSymbol())
-			toUpdatedPrices = append(toUpdatedPrices, info.GetPrice())
+			toUpdatedPrices = append(toUpdatedPrices, postedPrices[info.GetSymbol()])
 		}
 
 		// then we can append to request payloads
-		updatePricingParamsList = append(updatePricingParamsList, &UpdatePricingParams{
-			Symbols:   toUpdatedSymbols,
-			Prices:    toUpdatedPrices,
-			Timestamp: timestamp,
+		outcome.groups = append(outcome.groups, &groupOutcome{
+			params: &UpdatePricingParams{
+				Symbols:   toUpdatedSymbols,
+				Prices:    toUpdatedPrices,
+				Timestamp: timestamp,
+			},
 		})
 	}
 
 	// start request update to destination
-	var err error
-	for _, params := range updatePricingParamsList {
-		var reqBody []byte
-
-		reqBody, err = json.Marshal(params)
-		if err != nil {
-			logger.Errorf("could not marshal UpdatePricingParams to GO struct because: %v", err)
-			continue // current params error, try next
+	runConcurrently(config.destinationConcurrency, len(outcome.groups), func(i int) {
+		group := outcome.groups[i]
+		group.err = app.postPricingToDestination(ctx, group.params, config)
+	})
+
+	updateDstTime := app.clock.Now().Unix()
+	for _, group := range outcome.groups {
+		if group.err != nil {
+			for _, symbol := range group.params.Symbols {
+				outcome.failedSymbols[symbol] = group.err
+			}
+			continue
+		}
+		outcome.updatedSymbols = append(outcome.updatedSymbols, group.params.Symbols...)
+
+		// cache new current pricing after retreived previous pricing
+		for _, symbol := range group.params.Symbols {
+			logger.Debugf("update cache information of %s", symbol)
+			app.observations.reset(symbol)
+			if err := app.cache.UpdatePricing(
+				symbol,
+				postedPrices[symbol],
+				updateDstTime,
+				symbolMapPricing[symbol].GetTimestamp(),
+			); err != nil {
+				logger.Errorf("could not persist cache information of %s because: %v", symbol, err)
+			}
 		}
+	}
 
-		_, err = app.httpClient.PostJSON(config.updatePricingDataEndpoint, reqBody, config.destinationRetryCount)
-		if err != nil {
-			logger.Errorf("could not PostJSON because: %v", err)
-			continue // current params error, try next
+	// recheck destination by query its latest pricing
+	if config.enableRecheck {
+		rechecks := make([]*recheckOutcome, len(outcome.updatedSymbols))
+		runConcurrently(config.destinationConcurrency, len(rechecks), func(i int) {
+			rechecks[i] = app.recheckPricingAtDestination(ctx, outcome.updatedSymbols[i], config)
+		})
+		for _, recheck := range rechecks {
+			outcome.rechecks[recheck.symbol] = recheck
 		}
-		updatedSymbols = append(updatedSymbols, params.Symbols...)
-		logger.Infof("successfully updated pricing information of %+v prices %+v at timestamp %v", params.Symbols, params.Prices, params.Timestamp)
+	}
 
+	return outcome
+}
+
+func (app *App) postPricingToDestination(ctx context.Context, params *UpdatePricingParams, config *FeederConfig) error {
+	logger := log.FromContext(ctx, app.logger)
+
+	reqBody, err := json.Marshal(params)
+	if err != nil {
+		logger.Errorf("could not marshal UpdatePricingParams to GO struct because: %v", err)
+		return err
 	}
 
-	updateDstTime := time.Now().Unix()
-	// cache new current pricing after retreived previous pricing
-	for _, symbol := range updatedSymbols {
-		logger.Debugf("update cache information of %s", symbol)
-		cache.UpdatePricing(
-			symbol,
-			symbolMapPricing[symbol].GetPrice(),
-			updateDstTime,
-			symbolMapPricing[symbol].GetTimestamp(),
-		)
+	start := time.Now()
+	_, err = app.httpClient.PostJSON(ctx, config.updatePricingDataEndpoint, reqBody, config.destinationRetryPolicy)
+	observeDestinationPost(start, err)
+	if err != nil {
+		logger.Errorf("could not PostJSON because: %v", err)
+		return err
 	}
+	logger.Infof("successfully updated pricing information of %+v prices %+v at timestamp %v", params.Symbols, params.Prices, params.Timestamp)
+	return nil
+}
 
-	// recheck destination by query its latest pricing
-	if config.enableRecheck {
-		for _, symbol := range updatedSymbols {
-			currPricing, err := cache.GetPricing(symbol)
-			if err != nil {
-				logger.Errorf("RECHECKING: could not get pricing information of %s from cache because: %v", symbol, err)
-				continue
-			}
-			dstPricing, err := app.getPricingFromDst(symbol, config)
-			if err != nil {
-				logger.Errorf("RECHECKING: could not get pricing information of %s from destination because: %v", symbol, err)
-				continue
-			}
-			if !pricing.Equal(currPricing, dstPricing) {
-				logger.Errorf("REHECKING: current pricing of %s is not equal to updated destination pricing", symbol)
-				logger.Debugf(`symbol: %s currSymbol = %s dstSymbol = %s, 
-						currPrice = %f dstPrice = %v, 
-						currTime = %d dstTime = %d`,
-					symbol, currPricing.GetSymbol(), dstPricing.GetSymbol(),
-					currPricing.GetPrice(), dstPricing.GetPrice(),
-					currPricing.GetTimestamp(), dstPricing.GetTimestamp(),
-				)
-			} else {
-				logger.Infof("pricing of %s has been rechecked and confirmed", symbol)
-			}
-		}
+func (app *App) recheckPricingAtDestination(ctx context.Context, symbol string, config *FeederConfig) *recheckOutcome {
+	logger := log.FromContext(ctx, app.logger).With(log.Symbol(symbol))
+	outcome := &recheckOutcome{symbol: symbol}
+
+	currPricing, err := app.cache.GetPricing(symbol)
+	if err != nil {
+		logger.Errorf("RECHECKING: could not get pricing information of %s from cache because: %v", symbol, err)
+		outcome.err = err
+		return outcome
+	}
+	dstPricing, err := app.getPricingFromDst(ctx, symbol, config)
+	if err != nil {
+		logger.Errorf("RECHECKING: could not get pricing information of %s from destination because: %v", symbol, err)
+		outcome.err = err
+		return outcome
+	}
+	outcome.dstPrice = dstPricing.GetPrice()
+
+	if !pricing.Equal(currPricing, dstPricing) {
+		logger.Errorf("REHECKING: current pricing of %s is not equal to updated destination pricing", symbol)
+		logger.Debugf(`symbol: %s currSymbol = %s dstSymbol = %s, 
+				currPrice = %s dstPrice = %s, 
+				currTime = %d dstTime = %d`,
+			symbol, currPricing.GetSymbol(), dstPricing.GetSymbol(),
+			currPricing.GetPrice(), dstPricing.GetPrice(),
+			currPricing.GetTimestamp(), dstPricing.GetTimestamp(),
+		)
+		return outcome
 	}
 
-	return updatedSymbols, err
+	logger.Infof("pricing of %s has been rechecked and confirmed", symbol)
+	outcome.confirmed = true
+	return outcome
 }
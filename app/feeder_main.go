@@ -1,140 +1,237 @@
 package app
 
 import (
-	"os"
-	"os/signal"
+	"context"
 	"runtime/debug"
-	"sync"
-	"syscall"
 	"time"
 
 	"github.com/NuttapolCha/test-band-data-feeder/app/pricing"
-	"github.com/NuttapolCha/test-band-data-feeder/cache"
-)
-
-var (
-	dataSourceLock sync.Mutex
+	"github.com/NuttapolCha/test-band-data-feeder/log"
 )
 
 // StartDataAutomaticFeeder called by cmd after initialized application.
 // It does get data from source, caching in memory and update to destination if neccessary
+// until the application context is done.
 func (app *App) StartDataAutomaticFeeder() error {
 	logger := app.logger
 
-	config := getTimeConfig()
 	logger.Infof("Data Automatic Feeder is starting")
 
-	tickers := []*time.Ticker{
-		schedule(app.getDataAndFeed, config.interval),
+	// liveness and readiness are answered while bootstrapping as well
+	statusStopped, err := app.serveStatus(app.ctx, app.serverConfig)
+	if err != nil {
+		return err
 	}
 
-	quitChannel := make(chan os.Signal, 1)
-	signal.Notify(quitChannel, syscall.SIGINT, syscall.SIGTERM)
-	<-quitChannel
-	logger.Infof("Data Automatic Feeder has stopped")
+	// bootstrap before the first tick so restarting does not cause update storms
+	app.bootstrapCache(app.ctx, app.getFeederConfig())
+	defer app.closeCache()
 
-	for _, ticker := range tickers {
-		ticker.Stop()
+	closeAudit := app.openAuditSink(app.getFeederConfig())
+	defer closeAudit()
+
+	app.watchConfig()
+
+	feed := func(ctx context.Context) {
+		app.getDataAndFeed(ctx)
+	}
+	interval := func() time.Duration {
+		return app.getTimeConfig().interval
 	}
+	stopped := []<-chan struct{}{
+		schedule(app.ctx, app.clock, feed, interval, app.rescheduled),
+		statusStopped,
+	}
+
+	<-app.ctx.Done()
+	logger.Infof("Data Automatic Feeder is stopping, waiting for in-flight feeding to be cancelled")
+
+	for _, s := range stopped {
+		<-s
+	}
+	logger.Infof("Data Automatic Feeder has stopped")
 	return nil
 }
 
-// Feed called by cmd and run only once.
-func (app *App) Feed() {
+// Feed called by cmd and run only once, it returns report of the feeding.
+func (app *App) Feed() *FeedReport {
 	logger := app.logger
 	logger.Infof("Feed is starting")
-	app.getDataAndFeed()
+
+	app.bootstrapCache(app.ctx, app.getFeederConfig())
+	defer app.closeCache()
+
+	closeAudit := app.openAuditSink(app.getFeederConfig())
+	defer closeAudit()
+
+	return app.getDataAndFeed(app.ctx)
 }
 
-func (app *App) getDataAndFeed() {
-	logger := app.logger
+func (app *App) getDataAndFeed(ctx context.Context) (report *FeedReport) {
+	app.feedLock.Lock()
+	defer app.feedLock.Unlock()
+
+	report = newFeedReport(app.clock.Now())
+	defer func() {
+		report.FinishedAt = app.clock.Now()
+		app.handleReport(report)
+	}()
 
-	dataSourceLock.Lock()
-	defer dataSourceLock.Unlock()
-	logger.Infof("getting data from source..")
+	// every log of this cycle carries its cycle id
+	logger := app.logger.With(log.CycleID(report.CycleID))
+	ctx = log.NewContext(ctx, logger)
+	logger.Infof("cycle %s: getting data from source..", report.CycleID)
+
+	// each cycle must be done before its deadline
+	ctx, cancel := context.WithTimeout(ctx, app.getTimeConfig().cycleTimeout)
+	defer cancel()
 
 	defer func() {
 		if r := recover(); r != nil {
 			logger.Errorf("panic and recover because: %v", r)
 			logger.Debugf("debug stack = %s", debug.Stack())
+			report.addError("panic: %v", r)
 		}
 	}()
 
-	config := getFeederConfig()
+	config := app.getFeederConfig()
 	logger.Debugf("symbols: %v", config.symbols)
 
 	// request pricing information from data source
-	reqId, err := app.requestPricingFromSource(config)
+	reqId, err := app.requestPricingFromSource(ctx, config)
 	if err != nil {
 		logger.Errorf("could not request pricing from source because: %v", err)
-		return
+		report.addError("could not request pricing from source: %v", err)
+		return report
 	}
+	report.SourceRequestID = reqId
 
-	// some delay before getting the requested priceing
-	time.Sleep(config.waitTime)
-
-	// get pricing data from the requested
-	pricingResults, err := app.getRequestedPricingFromSource(reqId, config)
+	// get pricing data from the requested once it is resolved
+	pricingResults, err := app.pollRequestedPricingFromSource(ctx, reqId, config)
 	if err != nil {
 		logger.Errorf("could not get requested pricing from source because: %v", err)
-		return
+		report.addError("could not get requested pricing from source: %v", err)
+		return report
+	}
+
+	// malformed results are quarantined, the valid ones are still fed
+	pricingResults, rejected := app.validatePricingResults(ctx, pricingResults, config)
+	for _, r := range rejected {
+		s := report.symbol(r.result.Symbol)
+		s.Decision = DecisionRejected
+		s.Error = r.reason
+	}
+	if len(pricingResults) == 0 {
+		logger.Errorf("no valid pricing result from source for request %d", reqId)
+		report.addError("no valid pricing result from source for request %d", reqId)
+		return report
+	}
+
+	// classify every symbol first, so the urgent ones can be sent together
+	urgentPricing, stalePricing := app.classifyPricing(ctx, pricingResults, config, report)
+
+	// urgent updates are sent as one batch ahead of the stale ones
+	if len(urgentPricing) > 0 {
+		outcome := app.updatePricingToDestination(ctx, urgentPricing, config)
+		report.addOutcome(outcome)
+		app.logUpdateFailures(ctx, outcome.failedSymbols, "immediatly")
+		logger.Infof("successfully updated %+v pricing to destination immediatly", outcome.updatedSymbols)
 	}
 
-	// declare variables related to updating pricing to destination
-	symbolMapPricing := make(map[string]pricing.Information)
+	// update pricing to destination
+	outcome := app.updatePricingToDestination(ctx, stalePricing, config)
+	report.addOutcome(outcome)
+	app.logUpdateFailures(ctx, outcome.failedSymbols, "")
+	logger.Infof("updated symbols for this interval (exclude immediatly sent) are %+v", outcome.updatedSymbols)
+
+	return report
+}
+
+// classifyPricing splits pricing results into the ones need to be updated to destination
+// immediatly (urgent) and the ones need to be updated because destination is stale
+// or has never been updated. Unchanged symbols are left out.
+// The decision of every symbol is recorded into report.
+func (app *App) classifyPricing(ctx context.Context, pricingResults []*PricingResult, config *FeederConfig, report *FeedReport) (urgent, stale map[string]pricing.Information) {
+	logger := log.FromContext(ctx, app.logger)
+
+	urgent = make(map[string]pricing.Information)
+	stale = make(map[string]pricing.Information)
 
-	// check for each symbol need to update to destination or not
 	for _, currPricing := range pricingResults {
-		var is, immediatly bool
-		var prevUpdateDstTime int64
-		var err error
+		symbol := currPricing.GetSymbol()
 
-		symbol := currPricing.Symbol
-		prevPricing, err := cache.GetPricing(symbol)
+		s := report.symbol(symbol)
+		fetchedPrice := currPricing.GetPrice()
+		s.FetchedPrice = &fetchedPrice
+		s.ResolveTime = currPricing.GetTimestamp()
+
+		prevPricing, err := app.cache.GetPricing(symbol)
 		if err != nil {
-			logger.Infof("no previous pricing information found in cache, need update to destination")
-			is = true
-			goto sendToDestination
+			logger.With(log.Symbol(symbol)).Infof("no previous pricing information of %s found in cache, need update to destination", symbol)
+			s.Decision = DecisionFirstSeen
+			s.Reason = "no previous pricing in cache"
+			stale[symbol] = currPricing
+			continue
 		}
-		prevUpdateDstTime, err = cache.GetPrevUpdatedDstTime(symbol)
+		prevUpdateDstTime, err := app.cache.GetPrevUpdatedDstTime(symbol)
 		if err != nil {
-			logger.Errorf("could not get previous updated destination time of %s because: %v", symbol, err)
-			return
+			logger.With(log.Symbol(symbol)).Errorf("could not get previous updated destination time of %s because: %v, need update to destination", symbol, err)
+			s.Decision = DecisionFirstSeen
+			s.Reason = "no previous updated destination time in cache"
+			stale[symbol] = currPricing
+			continue
 		}
 
-		is, immediatly = app.isNeedUpdatePricingToDestination(prevUpdateDstTime, prevPricing, currPricing, config)
-		if immediatly {
-			// force update this symbol now (we cannot wait)
-			done := make(chan struct{})
-			go func(symbol string, price float64) {
-				urgentMap := map[string]pricing.Information{
-					symbol: currPricing,
-				}
-				updatedSymbol, err := app.updatePricingToDestination(urgentMap, config)
-				if err != nil {
-					logger.Errorf("could not update %s pricing to destination immediatly because: %v", symbol, err)
-					return
-				}
-				logger.Infof("successfully updated %+v pricing to destination immediatly", updatedSymbol)
-
-				done <- struct{}{}
-			}(currPricing.GetSymbol(), currPricing.GetPrice())
-
-			<-done
-			continue
+		decision := app.isNeedUpdatePricingToDestination(ctx, prevUpdateDstTime, prevPricing, currPricing, config)
+		s.Decision = decision.decision
+		s.Reason = decision.reason
+		if decision.diffRatio != nil {
+			diffRatio := decision.diffRatio.Float64()
+			s.DiffRatio = &diffRatio
 		}
 
-	sendToDestination:
-		if is {
-			symbolMapPricing[symbol] = currPricing
+		switch decision.decision {
+		case DecisionDeviation:
+			urgent[symbol] = currPricing
+		case DecisionStale:
+			stale[symbol] = currPricing
 		}
 	}
 
-	// update pricing to destination
-	updatedSymbols, err := app.updatePricingToDestination(symbolMapPricing, config)
+	return urgent, stale
+}
+
+// openAuditSink registers audit file sink if audit file is configured,
+// the returned function unregisters the sink and closes the audit file.
+func (app *App) openAuditSink(config *FeederConfig) func() {
+	logger := app.logger
+
+	if config.auditFilePath == "" {
+		return func() {}
+	}
+	sink, err := NewAuditFileSink(logger, config.auditFilePath)
 	if err != nil {
-		logger.Errorf("update pricing to destination not completed because: %v", err)
-		return
+		logger.Errorf("could not open audit file %s because: %v", config.auditFilePath, err)
+		return func() {}
+	}
+	app.AddReportSink(sink)
+	logger.Infof("report of every feeding is appended to %s", config.auditFilePath)
+
+	return func() {
+		app.removeReportSink(sink)
+		if err := sink.Close(); err != nil {
+			logger.Errorf("could not close audit file because: %v", err)
+		}
+	}
+}
+
+func (app *App) logUpdateFailures(ctx context.Context, failedSymbols map[string]error, how string) {
+	for symbol, err := range failedSymbols {
+		logger := log.FromContext(ctx, app.logger).With(log.Symbol(symbol))
+		if how != "" {
+			logger.Errorf("could not update %s pricing to destination %s because: %v", symbol, how, err)
+			continue
+		}
+		logger.Errorf("could not update %s pricing to destination because: %v", symbol, err)
 	}
-	logger.Infof("updated symbols for this interval (exclude immediatly sent) are %+v", updatedSymbols)
 }
@@ -0,0 +1,384 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NuttapolCha/test-band-data-feeder/mock"
+)
+
+func TestFeedFirstSeen(t *testing.T) {
+	t.Parallel()
+	ft := newFeederTest(t, nil, nil)
+	ft.source.setPrice("BTC", "40000")
+	ft.source.setPrice("ETH", "3000.5")
+
+	report := ft.feed()
+	expectDecisions(t, report, map[string]Decision{
+		"BTC": DecisionFirstSeen,
+		"ETH": DecisionFirstSeen,
+	})
+	ft.expectPosted(ft.posted("BTC=40000", "ETH=3000.5"))
+	for _, s := range report.Symbols {
+		if s.Recheck != RecheckConfirmed {
+			t.Errorf("%s: recheck is %q, want %q", s.Symbol, s.Recheck, RecheckConfirmed)
+		}
+	}
+}
+
+func TestFeedStaleAfterMaximumDelay(t *testing.T) {
+	t.Parallel()
+	ft := newFeederTest(t, map[string]interface{}{
+		"DataFeeder.MaximumDelay": 3600,
+		"DataFeeder.Symbols": []interface{}{
+			"BTC",
+			map[string]interface{}{"Symbol": "ETH", "MaximumDelay": 300},
+		},
+	}, nil)
+	ft.source.setPrice("BTC", "40000")
+	ft.source.setPrice("ETH", "3000")
+
+	ft.feed()
+	ft.expectPosted(ft.posted("BTC=40000", "ETH=3000"))
+
+	// unchanged prices are not posted until destination gets stale,
+	// ETH was updated after polling, it is decided 299s after that
+	ft.clock.Advance(299*time.Second - pollDelay)
+	expectDecisions(t, ft.feed(), map[string]Decision{
+		"BTC": DecisionSkip,
+		"ETH": DecisionSkip,
+	})
+	ft.expectPosted()
+
+	// ETH overrides the maximum delay, another pollDelay has passed
+	expectDecisions(t, ft.feed(), map[string]Decision{
+		"BTC": DecisionSkip,
+		"ETH": DecisionStale,
+	})
+	ft.expectPosted(ft.posted("ETH=3000"))
+
+	ft.clock.Advance(3300*time.Second - pollDelay)
+	expectDecisions(t, ft.feed(), map[string]Decision{
+		"BTC": DecisionStale,
+		"ETH": DecisionStale,
+	})
+	ft.expectPosted(ft.posted("BTC=40000", "ETH=3000"))
+}
+
+func TestFeedDeviationBeyondThreshold(t *testing.T) {
+	t.Parallel()
+	ft := newFeederTest(t, map[string]interface{}{
+		"DataFeeder.DiffThreshold": 0.1,
+	}, nil)
+	ft.source.setPrice("BTC", "40000")
+	ft.source.setPrice("ETH", "3000")
+
+	ft.feed()
+	ft.expectPosted(ft.posted("BTC=40000", "ETH=3000"))
+
+	// diff ratios are 0.07 of BTC and 0.17 of ETH
+	ft.clock.Advance(10 * time.Second)
+	ft.source.setPrice("BTC", "43000")
+	ft.source.setPrice("ETH", "3600")
+	expectDecisions(t, ft.feed(), map[string]Decision{
+		"BTC": DecisionSkip,
+		"ETH": DecisionDeviation,
+	})
+	ft.expectPosted(ft.posted("ETH=3600"))
+
+	// the deviation is measured against what destination has, not the previous fetch
+	ft.clock.Advance(10 * time.Second)
+	ft.source.setPrice("BTC", "44800")
+	expectDecisions(t, ft.feed(), map[string]Decision{
+		"BTC": DecisionDeviation,
+		"ETH": DecisionSkip,
+	})
+	ft.expectPosted(ft.posted("BTC=44800"))
+}
+
+func TestFeedMinUpdateInterval(t *testing.T) {
+	t.Parallel()
+	ft := newFeederTest(t, map[string]interface{}{
+		"DataFeeder.DiffThreshold":     0.1,
+		"DataFeeder.MinUpdateInterval": 60,
+		"DataFeeder.Symbols": []interface{}{
+			"BTC",
+			map[string]interface{}{"Symbol": "ETH", "MinUpdateInterval": 0},
+		},
+	}, nil)
+	ft.source.setPrice("BTC", "40000")
+	ft.source.setPrice("ETH", "3000")
+
+	ft.feed()
+	ft.expectPosted(ft.posted("BTC=40000", "ETH=3000"))
+
+	// both deviate 11s after the update, ETH overrides the minimum update interval
+	ft.clock.Advance(10 * time.Second)
+	ft.source.setPrice("BTC", "48000")
+	ft.source.setPrice("ETH", "3600")
+	expectDecisions(t, ft.feed(), map[string]Decision{
+		"BTC": DecisionSkip,
+		"ETH": DecisionDeviation,
+	})
+	ft.expectPosted(ft.posted("ETH=3600"))
+
+	// BTC is decided exactly the minimum update interval after its update
+	ft.clock.Advance(48 * time.Second)
+	expectDecisions(t, ft.feed(), map[string]Decision{
+		"BTC": DecisionDeviation,
+		"ETH": DecisionSkip,
+	})
+	ft.expectPosted(ft.posted("BTC=48000"))
+}
+
+func TestFeedConfirmationCount(t *testing.T) {
+	t.Parallel()
+	ft := newFeederTest(t, map[string]interface{}{
+		"DataFeeder.DiffThreshold":     0.1,
+		"DataFeeder.ConfirmationCount": 3,
+		"DataFeeder.Symbols":           []string{"BTC"},
+	}, nil)
+	ft.source.setPrice("BTC", "40000")
+
+	ft.feed()
+	ft.expectPosted(ft.posted("BTC=40000"))
+
+	expectWaiting := func(report *FeedReport, reason string) {
+		t.Helper()
+		expectDecisions(t, report, map[string]Decision{"BTC": DecisionSkip})
+		if got := report.bySymbol["BTC"].Reason; got != reason {
+			t.Errorf("BTC: skipped because %q, want %q", got, reason)
+		}
+	}
+
+	ft.source.setPrice("BTC", "48000")
+	for i := 1; i <= 2; i++ {
+		ft.clock.Advance(10 * time.Second)
+		expectWaiting(ft.feed(), fmt.Sprintf("waiting for confirmation %d/3", i))
+	}
+	ft.expectPosted()
+
+	// returning within the threshold resets the observations
+	ft.clock.Advance(10 * time.Second)
+	ft.source.setPrice("BTC", "41000")
+	expectDecisions(t, ft.feed(), map[string]Decision{"BTC": DecisionSkip})
+
+	ft.source.setPrice("BTC", "48000")
+	for i := 1; i <= 2; i++ {
+		ft.clock.Advance(10 * time.Second)
+		expectWaiting(ft.feed(), fmt.Sprintf("waiting for confirmation %d/3", i))
+	}
+	ft.expectPosted()
+
+	ft.clock.Advance(10 * time.Second)
+	expectDecisions(t, ft.feed(), map[string]Decision{"BTC": DecisionDeviation})
+	ft.expectPosted(ft.posted("BTC=48000"))
+}
+
+func TestFeedPartialSourceFailure(t *testing.T) {
+	t.Parallel()
+	ft := newFeederTest(t, map[string]interface{}{
+		"DataFeeder.Symbols": []string{"BTC", "ETH", "ADA"},
+	}, nil)
+	ft.source.setPrice("BTC", "40000")
+	ft.source.setPrice("ETH", "not a number")
+
+	// the valid ones are still fed
+	report := ft.feed()
+	expectDecisions(t, report, map[string]Decision{
+		"BTC": DecisionFirstSeen,
+		"ETH": DecisionRejected,
+		"ADA": DecisionRejected,
+	})
+	if report.Failed() {
+		t.Errorf("cycle failed because of some symbols: %v", report.Errors)
+	}
+	ft.expectPosted(ft.posted("BTC=40000"))
+
+	ft.clock.Advance(10 * time.Second)
+	ft.source.setPrice("ETH", "3000")
+	ft.source.setPrice("ADA", "1.2")
+	expectDecisions(t, ft.feed(), map[string]Decision{
+		"BTC": DecisionSkip,
+		"ETH": DecisionFirstSeen,
+		"ADA": DecisionFirstSeen,
+	})
+	ft.expectPosted(ft.posted("ADA=1.2", "ETH=3000"))
+
+	// nothing can be fed without data source, requesting is retried once
+	ft.clock.Advance(10 * time.Second)
+	ft.source.setUnavailable(true)
+	if report := ft.feedSleeping(retryDelay); !report.Failed() {
+		t.Errorf("cycle did not fail while data source is unavailable")
+	}
+	ft.expectPosted()
+}
+
+func TestFeedCircuitBreakerCoolDown(t *testing.T) {
+	t.Parallel()
+	ft := newFeederTest(t, map[string]interface{}{
+		"ExternalAPIs.CircuitBreaker.FailureThreshold": 2,
+		"ExternalAPIs.CircuitBreaker.CoolDown":         30,
+	}, nil)
+	ft.source.setPrice("BTC", "40000")
+	ft.source.setPrice("ETH", "3000")
+
+	// both attempts fail and open the circuit of data source after retryDelay
+	ft.source.setUnavailable(true)
+	if report := ft.feedSleeping(retryDelay); !report.Failed() {
+		t.Errorf("cycle did not fail while data source is unavailable")
+	}
+	received := ft.source.receivedCount()
+
+	// data source is not requested until the cool-down has passed,
+	// the cycle fails fast without sleeping
+	ft.clock.Advance(10 * time.Second)
+	ft.source.setUnavailable(false)
+	if report := ft.feedSleeping(); !report.Failed() {
+		t.Errorf("cycle did not fail while circuit of data source is open")
+	}
+	if n := ft.source.receivedCount() - received; n != 0 {
+		t.Errorf("data source received %d requests while its circuit is open", n)
+	}
+	ft.expectPosted()
+
+	ft.clock.Advance(20 * time.Second)
+	expectDecisions(t, ft.feed(), map[string]Decision{
+		"BTC": DecisionFirstSeen,
+		"ETH": DecisionFirstSeen,
+	})
+	ft.expectPosted(ft.posted("BTC=40000", "ETH=3000"))
+}
+
+func TestFeedRecheckMismatch(t *testing.T) {
+	t.Parallel()
+	ft := newFeederTest(t, nil, &mock.Scenario{
+		Seed: 1,
+		Faults: []*mock.Fault{
+			{Target: mock.TargetDestination, Endpoint: mock.EndpointUpdate, From: 1, To: 1, IgnoreUpdate: true},
+			{Target: mock.TargetDestination, Endpoint: mock.EndpointUpdate, From: 2, To: 2, PriceFactor: 1.01},
+		},
+	})
+	ft.source.setPrice("BTC", "40000")
+	ft.source.setPrice("ETH", "3000")
+
+	// destination responds OK but does not store the update
+	report := ft.feed()
+	ft.expectPosted(ft.posted("BTC=40000", "ETH=3000"))
+	for _, s := range report.Symbols {
+		if s.Recheck != RecheckMismatch {
+			t.Errorf("%s: recheck is %q, want %q", s.Symbol, s.Recheck, RecheckMismatch)
+		}
+	}
+
+	// destination stores a different price
+	ft.clock.Advance(10 * time.Second)
+	ft.source.setPrice("BTC", "48000")
+	report = ft.feed()
+	ft.expectPosted(ft.posted("BTC=48000"))
+	btc, ok := report.bySymbol["BTC"]
+	if !ok {
+		t.Fatalf("BTC: not in report")
+	}
+	if btc.Recheck != RecheckMismatch {
+		t.Errorf("BTC: recheck is %q, want %q", btc.Recheck, RecheckMismatch)
+	}
+	if btc.DstPrice == nil || btc.DstPrice.String() != "48480" {
+		t.Errorf("BTC: destination price is %s, want 48480", optionalPrice(btc.DstPrice))
+	}
+}
+
+func TestAutoFeederAcrossTicks(t *testing.T) {
+	t.Parallel()
+	ft := newFeederTest(t, map[string]interface{}{
+		"DataFeeder.MaximumDelay": 3600,
+	}, nil)
+	ft.source.setPrice("BTC", "40000")
+	ft.source.setPrice("ETH", "3000")
+
+	sink := newPausingSink(ft.app.ctx)
+	ft.app.AddReportSink(sink)
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- ft.app.StartDataAutomaticFeeder()
+	}()
+
+	// the first cycle starts one interval after starting,
+	// every cycle takes pollDelay of the interval to poll the requested pricing
+	ft.clock.BlockUntilTickers(1)
+	ft.clock.Advance(10 * time.Second)
+	ft.advanceSleep(pollDelay)
+	sink.wait(t)
+	ft.expectPosted(ft.posted("BTC=40000", "ETH=3000"))
+
+	ft.clock.Advance(10*time.Second - pollDelay)
+	sink.resume()
+	ft.advanceSleep(pollDelay)
+	expectDecisions(t, sink.wait(t), map[string]Decision{
+		"BTC": DecisionSkip,
+		"ETH": DecisionSkip,
+	})
+	ft.expectPosted()
+
+	ft.clock.Advance(10*time.Second - pollDelay)
+	ft.source.setPrice("BTC", "48000")
+	sink.resume()
+	ft.advanceSleep(pollDelay)
+	expectDecisions(t, sink.wait(t), map[string]Decision{
+		"BTC": DecisionDeviation,
+		"ETH": DecisionSkip,
+	})
+	ft.expectPosted(ft.posted("BTC=48000"))
+
+	// ETH was last updated by the first cycle, an hour ago
+	ft.clock.Advance(3590 * time.Second)
+	sink.resume()
+	ft.advanceSleep(pollDelay)
+	expectDecisions(t, sink.wait(t), map[string]Decision{
+		"BTC": DecisionSkip,
+		"ETH": DecisionStale,
+	})
+	ft.expectPosted(ft.posted("ETH=3000"))
+
+	ft.cancel()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("auto feeder stopped with error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("auto feeder did not stop within 10s after cancelled")
+	}
+}
+
+func TestFeedAuditSinkClosed(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	ft := newFeederTest(t, map[string]interface{}{
+		"Audit.FilePath": path,
+	}, nil)
+	ft.source.setPrice("BTC", "40000")
+	ft.source.setPrice("ETH", "3000")
+	sinks := len(ft.app.reportSinks)
+
+	// every feed-once opens the audit file and closes it afterwards
+	for i := 0; i < 2; i++ {
+		ft.feed()
+		ft.clock.Advance(10 * time.Second)
+	}
+	if n := len(ft.app.reportSinks); n != sinks {
+		t.Errorf("%d report sinks after closing the audit file, want %d", n, sinks)
+	}
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read audit file: %v", err)
+	}
+	if lines := strings.Count(string(bs), "\n"); lines != 2 {
+		t.Errorf("%d reports are audited after 2 cycles, want 2", lines)
+	}
+}
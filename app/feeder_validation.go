@@ -0,0 +1,98 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/NuttapolCha/test-band-data-feeder/log"
+)
+
+// rejectedPricingResult is a quarantined pricing result with the reason why it cannot be fed.
+type rejectedPricingResult struct {
+	result *PricingResult
+	reason string
+}
+
+// validatePricingResults returns valid pricing results of the configured symbols.
+// Invalid results are quarantined and logged per symbol, so one bad symbol
+// does not prevent feeding the others. Symbols missing from data source are rejected as well.
+func (app *App) validatePricingResults(ctx context.Context, pricingResults []*PricingResult, config *FeederConfig) (valid []*PricingResult, rejected []*rejectedPricingResult) {
+	logger := log.FromContext(ctx, app.logger)
+
+	configured := make(map[string]bool, len(config.symbols))
+	for _, symbol := range config.symbols {
+		configured[symbol] = true
+	}
+	occurrences := make(map[string]int, len(pricingResults))
+	for _, result := range pricingResults {
+		if result != nil {
+			occurrences[result.Symbol]++
+		}
+	}
+
+	currTime := app.clock.Now().Unix()
+	valid = make([]*PricingResult, 0, len(pricingResults))
+	rejected = make([]*rejectedPricingResult, 0)
+	reject := func(result *PricingResult, format string, args ...interface{}) {
+		rejected = append(rejected, &rejectedPricingResult{
+			result: result,
+			reason: fmt.Sprintf(format, args...),
+		})
+	}
+
+	for _, result := range pricingResults {
+		if result == nil {
+			reject(&PricingResult{}, "empty pricing result")
+			continue
+		}
+
+		symbol := result.Symbol
+		if !configured[symbol] {
+			reject(result, "unknown symbol %q", symbol)
+			continue
+		}
+		// we cannot tell which one is right, so none of them
+		if occurrences[symbol] > 1 {
+			reject(result, "symbol is duplicated %d times", occurrences[symbol])
+			continue
+		}
+		if err := result.parse(); err != nil {
+			reject(result, "%v", err)
+			continue
+		}
+		if result.GetPrice().Sign() <= 0 {
+			reject(result, "price must be positive but got %s", result.GetPrice())
+			continue
+		}
+
+		resolveTime := result.GetTimestamp()
+		if resolveTime > currTime+int64(config.maxClockSkew/time.Second) {
+			reject(result, "resolve time %d is in the future (now %d)", resolveTime, currTime)
+			continue
+		}
+		if resolveTime < currTime-int64(config.maxResultAge/time.Second) {
+			reject(result, "resolve time %d is older than %v (now %d)", resolveTime, config.maxResultAge, currTime)
+			continue
+		}
+
+		valid = append(valid, result)
+	}
+
+	for _, r := range rejected {
+		logger.With(log.Symbol(r.result.Symbol)).Warnf(
+			"QUARANTINE: rejected pricing result of symbol %q because: %s (request_id=%q px=%q multiplier=%q resolve_time=%q)",
+			r.result.Symbol, r.reason, r.result.RequestID, r.result.Px, r.result.Multiplier, r.result.ResolveTime,
+		)
+	}
+
+	// requested symbols missing from data source are worth knowing as well
+	for _, symbol := range config.symbols {
+		if occurrences[symbol] == 0 {
+			logger.With(log.Symbol(symbol)).Warnf("QUARANTINE: data source did not return pricing result of symbol %q", symbol)
+			reject(&PricingResult{Symbol: symbol}, "missing from data source")
+		}
+	}
+
+	return valid, rejected
+}
@@ -0,0 +1,396 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NuttapolCha/test-band-data-feeder/app/pricing"
+	"github.com/NuttapolCha/test-band-data-feeder/cache"
+	"github.com/NuttapolCha/test-band-data-feeder/clock"
+	"github.com/NuttapolCha/test-band-data-feeder/connector"
+	"github.com/NuttapolCha/test-band-data-feeder/log"
+	"github.com/NuttapolCha/test-band-data-feeder/mock"
+	"github.com/spf13/viper"
+)
+
+// testSource is a data source whose prices are set by the test, px is the price
+// itself (multiplier 1) and requests are resolved at the time they are requested.
+type testSource struct {
+	clock clock.Clock
+
+	mu           sync.Mutex
+	prices       map[string]string
+	unavailable  bool
+	nextID       int
+	requests     map[int][]*PricingResult
+	lastResolved int64
+	received     int
+}
+
+func newTestSource(clk clock.Clock) *testSource {
+	return &testSource{
+		clock:    clk,
+		prices:   make(map[string]string),
+		nextID:   1,
+		requests: make(map[int][]*PricingResult),
+	}
+}
+
+// setPrice sets px of symbol, an empty px leaves the symbol out of the results.
+func (s *testSource) setPrice(symbol, px string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if px == "" {
+		delete(s.prices, symbol)
+		return
+	}
+	s.prices[symbol] = px
+}
+
+func (s *testSource) lastResolveTime() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastResolved
+}
+
+// receivedCount returns how many requests have reached the source.
+func (s *testSource) receivedCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.received
+}
+
+// setUnavailable makes every request fail with 503.
+func (s *testSource) setUnavailable(unavailable bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unavailable = unavailable
+}
+
+func (s *testSource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.received++
+	if s.unavailable {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/request":
+		params := &RequestPricingDataSourceParams{}
+		if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		id := s.nextID
+		s.nextID++
+		s.lastResolved = s.clock.Now().Unix()
+		resolveTime := strconv.FormatInt(s.lastResolved, 10)
+		for _, symbol := range params.Symbols {
+			px, ok := s.prices[symbol]
+			if !ok {
+				continue
+			}
+			s.requests[id] = append(s.requests[id], &PricingResult{
+				Multiplier:  "1",
+				Px:          px,
+				RequestID:   strconv.Itoa(id),
+				ResolveTime: resolveTime,
+				Symbol:      symbol,
+			})
+		}
+		json.NewEncoder(w).Encode(&RequestPricingDataSourceResp{ID: id})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/request/"):
+		id, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/request/"))
+		results, ok := s.requests[id]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(&PricingResultResp{PricingResults: results})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// recordingDestination records every update posted to the wrapped destination.
+type recordingDestination struct {
+	handler http.Handler
+
+	mu     sync.Mutex
+	posted []*UpdatePricingParams
+}
+
+func (d *recordingDestination) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost && r.URL.Path == "/update" {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		params := &UpdatePricingParams{}
+		if err := json.Unmarshal(body, params); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		d.mu.Lock()
+		d.posted = append(d.posted, params)
+		d.mu.Unlock()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	d.handler.ServeHTTP(w, r)
+}
+
+// takePosted returns updates posted since the last call.
+func (d *recordingDestination) takePosted() []*UpdatePricingParams {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	posted := d.posted
+	d.posted = nil
+	return posted
+}
+
+// pausingSink hands report of every cycle to the test and pauses the feeder
+// until the test resumes it, so the test can change the world between cycles.
+type pausingSink struct {
+	ctx     context.Context
+	reports chan *FeedReport
+	resumed chan struct{}
+}
+
+func newPausingSink(ctx context.Context) *pausingSink {
+	return &pausingSink{
+		ctx:     ctx,
+		reports: make(chan *FeedReport),
+		resumed: make(chan struct{}),
+	}
+}
+
+func (s *pausingSink) HandleReport(report *FeedReport) {
+	select {
+	case s.reports <- report:
+	case <-s.ctx.Done():
+		return
+	}
+	select {
+	case <-s.resumed:
+	case <-s.ctx.Done():
+	}
+}
+
+// wait returns report of the next cycle, the feeder is paused until resume is called.
+func (s *pausingSink) wait(t *testing.T) *FeedReport {
+	t.Helper()
+	select {
+	case report := <-s.reports:
+		return report
+	case <-time.After(10 * time.Second):
+		t.Fatalf("no feeding cycle has completed within 10s")
+		return nil
+	}
+}
+
+func (s *pausingSink) resume() {
+	s.resumed <- struct{}{}
+}
+
+// feederTest is a feeder wired to stand-ins of data source and destination.
+type feederTest struct {
+	t           *testing.T
+	app         *App
+	cancel      context.CancelFunc
+	clock       *clock.Manual
+	source      *testSource
+	destination *recordingDestination
+}
+
+// time the feeder sleeps on the clock, before polling the requested pricing
+// and before retrying a failed request to data source
+const (
+	pollDelay  = time.Second
+	retryDelay = 500 * time.Millisecond
+)
+
+// newFeederTest configures the feeder through a viper instance as cmd does, config overrides the defaults of the test.
+// Destination faults are injected from scenario if not nil.
+func newFeederTest(t *testing.T, config map[string]interface{}, scenario *mock.Scenario) *feederTest {
+	t.Helper()
+	ft := &feederTest{
+		t:     t,
+		clock: clock.NewManual(time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	ft.source = newTestSource(ft.clock)
+
+	v := viper.New()
+	v.Set("Log.Output", filepath.Join(t.TempDir(), "feeder.log"))
+	logger, err := log.NewLogger(v)
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	t.Cleanup(func() { logger.Close() })
+
+	var faults *mock.FaultInjector
+	if scenario != nil {
+		faults = mock.NewFaultInjector(logger, scenario)
+	}
+	ft.destination = &recordingDestination{handler: mock.NewDestination(logger, faults)}
+
+	sourceServer := httptest.NewServer(ft.source)
+	t.Cleanup(sourceServer.Close)
+	destinationServer := httptest.NewServer(ft.destination)
+	t.Cleanup(destinationServer.Close)
+
+	defaults := map[string]interface{}{
+		"ExternalAPIs.DataSource.RequestPricingData":     sourceServer.URL + "/request",
+		"ExternalAPIs.DataSource.GetPricingData":         sourceServer.URL + "/request",
+		"ExternalAPIs.Destination.UpdatePricingData":     destinationServer.URL + "/update",
+		"ExternalAPIs.Destination.GetUpdatedPricingData": destinationServer.URL + "/get_price",
+		"DataFeeder.Symbols":                             []string{"BTC", "ETH"},
+		"DataFeeder.Interval":                            10,
+		"DataFeeder.CycleTimeout":                        5,
+		"DataFeeder.PollInitialDelay":                    pollDelay.Seconds(),
+		"DataFeeder.PollDeadline":                        4,
+		"ExternalAPIs.DataSource.Retry.BaseDelay":        retryDelay.Seconds(),
+		"ExternalAPIs.DataSource.Retry.Jitter":           0,
+		"DataFeeder.EnableRecheck":                       true,
+	}
+	for key, val := range defaults {
+		v.Set(key, val)
+	}
+	for key, val := range config {
+		v.Set(key, val)
+	}
+
+	appConfig, err := LoadConfig(v)
+	if err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	ft.cancel = cancel
+	ft.app = New(ctx, logger, appConfig, nil, cache.NewLatestPricing(), ft.clock, connector.NewCustomHttpClient(logger, v, ft.clock))
+
+	return ft
+}
+
+// feed runs a single feeding cycle like feed-once does,
+// the clock is advanced by pollDelay while the feeder waits to poll the requested pricing.
+func (ft *feederTest) feed() *FeedReport {
+	ft.t.Helper()
+	return ft.feedSleeping(pollDelay)
+}
+
+// feedSleeping runs a single feeding cycle, the clock is advanced by each of sleeps
+// in turn as the feeder sleeps, the cycle is expected not to sleep any further.
+func (ft *feederTest) feedSleeping(sleeps ...time.Duration) *FeedReport {
+	ft.t.Helper()
+
+	reports := make(chan *FeedReport, 1)
+	go func() {
+		reports <- ft.app.Feed()
+	}()
+	for _, d := range sleeps {
+		ft.advanceSleep(d)
+	}
+
+	select {
+	case report := <-reports:
+		if report.Failed() {
+			ft.t.Logf("cycle %s failed: %v", report.CycleID, report.Errors)
+		}
+		return report
+	case <-time.After(10 * time.Second):
+		ft.t.Fatalf("feeding cycle did not complete within 10s")
+		return nil
+	}
+}
+
+// advanceSleep waits for the feeder to sleep on the clock and then advances the clock by d.
+func (ft *feederTest) advanceSleep(d time.Duration) {
+	ft.t.Helper()
+
+	sleeping := make(chan struct{})
+	go func() {
+		ft.clock.BlockUntilSleepers(1)
+		close(sleeping)
+	}()
+	select {
+	case <-sleeping:
+	case <-time.After(10 * time.Second):
+		ft.t.Fatalf("feeder did not sleep on the clock within 10s, expected a sleep of %v", d)
+	}
+	ft.clock.Advance(d)
+}
+
+// expectPosted fails the test unless exactly want have been posted since the last call,
+// every update is written as "SYMBOL=PRICE,... @TIMESTAMP".
+func (ft *feederTest) expectPosted(want ...string) {
+	ft.t.Helper()
+
+	posted := ft.destination.takePosted()
+	got := make([]string, 0, len(posted))
+	for _, params := range posted {
+		got = append(got, formatParams(params))
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		ft.t.Errorf("posted updates:\n  got  %q\n  want %q", got, want)
+	}
+}
+
+// posted formats an update the way expectPosted expects, timestamp is the time of the latest source request.
+func (ft *feederTest) posted(pairs ...string) string {
+	symbols := make([]string, 0, len(pairs))
+	prices := make([]pricing.Price, 0, len(pairs))
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		price, err := pricing.ParsePrice(kv[1])
+		if err != nil {
+			ft.t.Fatalf("invalid price %q: %v", pair, err)
+		}
+		symbols = append(symbols, kv[0])
+		prices = append(prices, price)
+	}
+	return formatParams(&UpdatePricingParams{
+		Symbols:   symbols,
+		Prices:    prices,
+		Timestamp: ft.source.lastResolveTime(),
+	})
+}
+
+func formatParams(params *UpdatePricingParams) string {
+	pairs := make([]string, 0, len(params.Symbols))
+	for i, symbol := range params.Symbols {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", symbol, params.Prices[i]))
+	}
+	return fmt.Sprintf("%s @%d", strings.Join(pairs, ","), params.Timestamp)
+}
+
+// expectDecisions fails the test unless symbols of report were decided as want, keyed by symbol.
+func expectDecisions(t *testing.T, report *FeedReport, want map[string]Decision) {
+	t.Helper()
+
+	for symbol, decision := range want {
+		s, ok := report.bySymbol[symbol]
+		if !ok {
+			t.Errorf("%s: not in report", symbol)
+			continue
+		}
+		if s.Decision != decision {
+			t.Errorf("%s: decision is %s (%s), want %s", symbol, s.Decision, s.Reason, decision)
+		}
+	}
+}
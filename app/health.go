@@ -0,0 +1,164 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/NuttapolCha/test-band-data-feeder/connector"
+)
+
+// healthState is what liveness and readiness are judged from.
+type healthState struct {
+	mu           sync.Mutex
+	startedAt    time.Time
+	lastCycleAt  time.Time
+	lastCycleID  string
+	bootstrapped bool
+
+	// cycles failed in a row since the last successful one
+	consecutiveFailures int
+}
+
+func newHealthState(startedAt time.Time) *healthState {
+	return &healthState{
+		startedAt: startedAt,
+	}
+}
+
+func (h *healthState) markBootstrapped() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.bootstrapped = true
+}
+
+// HandleReport records the cycle has completed, failed cycles count as well
+// since they prove the feeder is not wedged, but too many of them in a row fail liveness.
+func (h *healthState) HandleReport(r *FeedReport) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastCycleAt = r.FinishedAt
+	h.lastCycleID = r.CycleID
+	if r.Failed() {
+		h.consecutiveFailures++
+	} else {
+		h.consecutiveFailures = 0
+	}
+}
+
+type livenessResp struct {
+	Alive               bool       `json:"alive"`
+	Reason              string     `json:"reason,omitempty"`
+	StartedAt           time.Time  `json:"started_at"`
+	LastCycleAt         *time.Time `json:"last_cycle_at,omitempty"`
+	LastCycleID         string     `json:"last_cycle_id,omitempty"`
+	MaxCycleDelay       string     `json:"max_cycle_delay"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+}
+
+type symbolReadiness struct {
+	Symbol        string `json:"symbol"`
+	Ready         bool   `json:"ready"`
+	Reason        string `json:"reason,omitempty"`
+	UpdateDstTime int64  `json:"update_dst_time,omitempty"`
+	AgeSeconds    int64  `json:"age_seconds,omitempty"`
+	MaximumDelay  int64  `json:"maximum_delay"`
+}
+
+type readinessResp struct {
+	Ready           bool                              `json:"ready"`
+	Bootstrapped    bool                              `json:"bootstrapped"`
+	Symbols         []*symbolReadiness                `json:"symbols"`
+	CircuitBreakers map[string]connector.BreakerState `json:"circuit_breakers"`
+}
+
+// livenessHandler fails if no cycle has completed within the configured number of intervals
+// or as many cycles have failed in a row.
+func (app *App) livenessHandler(config *ServerConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h := app.health
+		h.mu.Lock()
+		resp := &livenessResp{
+			Alive:               true,
+			StartedAt:           h.startedAt,
+			LastCycleID:         h.lastCycleID,
+			ConsecutiveFailures: h.consecutiveFailures,
+		}
+		last := h.startedAt
+		if !h.lastCycleAt.IsZero() {
+			last = h.lastCycleAt
+			resp.LastCycleAt = &last
+		}
+		h.mu.Unlock()
+
+		timeConfig := app.getTimeConfig()
+		// the first cycle starts one interval after starting
+		maxCycleDelay := time.Duration(config.maxMissedIntervals)*timeConfig.interval + timeConfig.cycleTimeout
+		resp.MaxCycleDelay = maxCycleDelay.String()
+
+		if since := app.clock.Now().Sub(last); since > maxCycleDelay {
+			resp.Alive = false
+			resp.Reason = "no feeding cycle has completed for " + since.Truncate(time.Second).String()
+		} else if resp.ConsecutiveFailures >= config.maxMissedIntervals {
+			resp.Alive = false
+			resp.Reason = fmt.Sprintf("last %d feeding cycles have failed", resp.ConsecutiveFailures)
+		}
+
+		writeHealthResp(w, resp.Alive, resp)
+	}
+}
+
+// readinessHandler fails if cache has not been bootstrapped or any symbol at destination is overdue.
+func (app *App) readinessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h := app.health
+		h.mu.Lock()
+		bootstrapped := h.bootstrapped
+		h.mu.Unlock()
+
+		config := app.getFeederConfig()
+		resp := &readinessResp{
+			Ready:           bootstrapped,
+			Bootstrapped:    bootstrapped,
+			Symbols:         make([]*symbolReadiness, 0, len(config.symbols)),
+			CircuitBreakers: app.httpClient.BreakerStates(),
+		}
+
+		now := app.clock.Now().Unix()
+		for _, symbol := range config.symbols {
+			s := &symbolReadiness{
+				Symbol:       symbol,
+				Ready:        true,
+				MaximumDelay: config.policyOf(symbol).maximumDelay,
+			}
+			updateDstTime, err := app.cache.GetPrevUpdatedDstTime(symbol)
+			if err != nil {
+				s.Ready = false
+				s.Reason = "destination has never been updated"
+			} else {
+				s.UpdateDstTime = updateDstTime
+				s.AgeSeconds = now - updateDstTime
+				if s.AgeSeconds > s.MaximumDelay {
+					s.Ready = false
+					s.Reason = "destination pricing is older than maximum delay"
+				}
+			}
+			resp.Ready = resp.Ready && s.Ready
+			resp.Symbols = append(resp.Symbols, s)
+		}
+
+		writeHealthResp(w, resp.Ready, resp)
+	}
+}
+
+func writeHealthResp(w http.ResponseWriter, ok bool, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(body)
+}
@@ -0,0 +1,106 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// getHealth requests handler like the orchestrator does and decodes the body into resp.
+func getHealth(t *testing.T, handler http.Handler, path string, resp interface{}) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if err := json.NewDecoder(rec.Body).Decode(resp); err != nil {
+		t.Fatalf("%s: could not decode body: %v", path, err)
+	}
+	return rec.Code
+}
+
+// readyzBody is readinessResp without circuit breakers, their states are only marshalled.
+type readyzBody struct {
+	Ready        bool               `json:"ready"`
+	Bootstrapped bool               `json:"bootstrapped"`
+	Symbols      []*symbolReadiness `json:"symbols"`
+}
+
+func TestReadyAfterBootstrap(t *testing.T) {
+	t.Parallel()
+	ft := newFeederTest(t, nil, nil)
+	ft.source.setPrice("BTC", "40000")
+	ft.source.setPrice("ETH", "3000")
+	handler := ft.app.readinessHandler()
+
+	resp := &readyzBody{}
+	if code := getHealth(t, handler, "/readyz", resp); code != http.StatusServiceUnavailable || resp.Bootstrapped {
+		t.Errorf("readiness before bootstrap is %d (bootstrapped %v), want 503", code, resp.Bootstrapped)
+	}
+
+	ft.feed()
+	resp = &readyzBody{}
+	if code := getHealth(t, handler, "/readyz", resp); code != http.StatusOK || !resp.Ready {
+		t.Errorf("readiness after bootstrap and feeding is %d: %+v, want 200", code, resp)
+	}
+	for _, s := range resp.Symbols {
+		if !s.Ready {
+			t.Errorf("%s: not ready because: %s", s.Symbol, s.Reason)
+		}
+	}
+
+	// fed symbols get overdue once the maximum delay has passed
+	ft.clock.Advance(3601 * time.Second)
+	resp = &readyzBody{}
+	if code := getHealth(t, handler, "/readyz", resp); code != http.StatusServiceUnavailable || resp.Ready {
+		t.Errorf("readiness after maximum delay is %d, want 503", code)
+	}
+}
+
+func TestUnhealthyAfterConsecutiveFailedCycles(t *testing.T) {
+	t.Parallel()
+	ft := newFeederTest(t, map[string]interface{}{
+		"Server.Health.MaxMissedIntervals":             3,
+		"ExternalAPIs.CircuitBreaker.FailureThreshold": -1,
+	}, nil)
+	ft.source.setPrice("BTC", "40000")
+	ft.source.setPrice("ETH", "3000")
+	handler := ft.app.livenessHandler(ft.app.serverConfig)
+
+	resp := &livenessResp{}
+	if code := getHealth(t, handler, "/healthz", resp); code != http.StatusOK {
+		t.Errorf("liveness on starting is %d: %s, want 200", code, resp.Reason)
+	}
+
+	ft.source.setUnavailable(true)
+	for i := 1; i <= 3; i++ {
+		ft.clock.Advance(10 * time.Second)
+		if report := ft.feedSleeping(retryDelay); !report.Failed() {
+			t.Fatalf("cycle %d did not fail while data source is unavailable", i)
+		}
+		resp = &livenessResp{}
+		code := getHealth(t, handler, "/healthz", resp)
+		if i < 3 && code != http.StatusOK {
+			t.Errorf("liveness after %d failed cycles is %d: %s, want 200", i, code, resp.Reason)
+		}
+		if i == 3 && (code != http.StatusServiceUnavailable || resp.ConsecutiveFailures != 3) {
+			t.Errorf("liveness after %d failed cycles is %d (%d failures), want 503", i, code, resp.ConsecutiveFailures)
+		}
+	}
+
+	// a successful cycle ends the streak
+	ft.clock.Advance(10 * time.Second)
+	ft.source.setUnavailable(false)
+	ft.feed()
+	resp = &livenessResp{}
+	if code := getHealth(t, handler, "/healthz", resp); code != http.StatusOK || resp.ConsecutiveFailures != 0 {
+		t.Errorf("liveness after a successful cycle is %d: %s, want 200", code, resp.Reason)
+	}
+
+	// a wedged feeder fails liveness without failing any cycle
+	ft.clock.Advance(36 * time.Second)
+	resp = &livenessResp{}
+	if code := getHealth(t, handler, "/healthz", resp); code != http.StatusServiceUnavailable {
+		t.Errorf("liveness after missing 3 intervals is %d, want 503", code)
+	}
+}
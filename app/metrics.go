@@ -0,0 +1,177 @@
+package app
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/NuttapolCha/test-band-data-feeder/cache"
+	"github.com/NuttapolCha/test-band-data-feeder/connector"
+	"github.com/NuttapolCha/test-band-data-feeder/metrics"
+)
+
+var (
+	cyclesTotal = metrics.NewCounterVec(
+		"feeder_cycles_total",
+		"Number of feeding cycles run.",
+	)
+	cyclesFailedTotal = metrics.NewCounterVec(
+		"feeder_cycles_failed_total",
+		"Number of feeding cycles could not be done at all.",
+	)
+	cycleDuration = metrics.NewHistogramVec(
+		"feeder_cycle_duration_seconds",
+		"Duration of each feeding cycle.",
+		[]float64{.5, 1, 2, 5, 10, 20, 30, 60},
+	)
+	sourceRequestDuration = metrics.NewHistogramVec(
+		"feeder_source_request_duration_seconds",
+		"Latency of requesting pricing (request) and getting the requested pricing until resolved (poll) from data source.",
+		[]float64{.1, .25, .5, 1, 2, 5, 10, 20, 30},
+		"operation",
+	)
+	sourceRequestFailuresTotal = metrics.NewCounterVec(
+		"feeder_source_request_failures_total",
+		"Number of failed requests to data source by operation.",
+		"operation",
+	)
+	destinationPostDuration = metrics.NewHistogramVec(
+		"feeder_destination_post_duration_seconds",
+		"Latency of posting a group of pricing to destination including retries.",
+		nil,
+	)
+	destinationPostFailuresTotal = metrics.NewCounterVec(
+		"feeder_destination_post_failures_total",
+		"Number of failed posts to destination by the last response status code, error or circuit_open.",
+		"status",
+	)
+	symbolLastPrice = metrics.NewGaugeVec(
+		"feeder_symbol_last_price",
+		"Last valid price fetched from data source.",
+		"symbol",
+	)
+	symbolUpdateAge = metrics.NewGaugeVec(
+		"feeder_symbol_update_age_seconds",
+		"Seconds since destination pricing of the symbol was updated.",
+		"symbol",
+	)
+	symbolUpdateAgeRatio = metrics.NewGaugeVec(
+		"feeder_symbol_update_age_ratio",
+		"Seconds since destination pricing of the symbol was updated divided by its maximum delay, above 1 means overdue.",
+		"symbol",
+	)
+	symbolDeviationRatio = metrics.NewGaugeVec(
+		"feeder_symbol_deviation_ratio",
+		"Last observed deviation ratio between fetched price and the latest destination price.",
+		"symbol",
+	)
+	symbolRejectedTotal = metrics.NewCounterVec(
+		"feeder_symbol_rejected_total",
+		"Number of invalid or missing pricing results from data source.",
+		"symbol",
+	)
+	recheckMismatchesTotal = metrics.NewCounterVec(
+		"feeder_recheck_mismatches_total",
+		"Number of rechecks finding destination pricing different from what has been posted.",
+		"symbol",
+	)
+)
+
+// observeSourceRequest records latency and failure of a data source operation.
+func observeSourceRequest(operation string, start time.Time, err error) {
+	sourceRequestDuration.Observe(time.Since(start).Seconds(), operation)
+	if err != nil {
+		sourceRequestFailuresTotal.Inc(operation)
+	}
+}
+
+// observeDestinationPost records latency and failure of posting pricing to destination.
+func observeDestinationPost(start time.Time, err error) {
+	destinationPostDuration.Observe(time.Since(start).Seconds())
+	if err == nil {
+		return
+	}
+
+	status := "error"
+	var reqErr *connector.RequestError
+	switch {
+	case errors.Is(err, connector.ErrCircuitOpen):
+		status = "circuit_open"
+	case errors.As(err, &reqErr) && reqErr.StatusCode != 0:
+		status = strconv.Itoa(reqErr.StatusCode)
+	}
+	destinationPostFailuresTotal.Inc(status)
+}
+
+// metricsReportSink turns every feed report into metrics.
+type metricsReportSink struct {
+	feederConfig func() *FeederConfig
+	cache        cache.PricingStore
+}
+
+func (s *metricsReportSink) HandleReport(r *FeedReport) {
+	cyclesTotal.Inc()
+	if r.Failed() {
+		cyclesFailedTotal.Inc()
+	}
+	cycleDuration.Observe(r.FinishedAt.Sub(r.StartedAt).Seconds())
+
+	for _, symbol := range r.Symbols {
+		if symbol.FetchedPrice != nil {
+			symbolLastPrice.Set(symbol.FetchedPrice.Float64(), symbol.Symbol)
+		}
+		if symbol.DiffRatio != nil {
+			symbolDeviationRatio.Set(*symbol.DiffRatio, symbol.Symbol)
+		}
+		if symbol.Decision == DecisionRejected {
+			symbolRejectedTotal.Inc(symbol.Symbol)
+		}
+		if symbol.Recheck == RecheckMismatch {
+			recheckMismatchesTotal.Inc(symbol.Symbol)
+		}
+	}
+
+	config := s.feederConfig()
+	// ages as of the end of the cycle
+	now := r.FinishedAt.Unix()
+	for _, symbol := range config.symbols {
+		updateDstTime, err := s.cache.GetPrevUpdatedDstTime(symbol)
+		if err != nil {
+			continue
+		}
+		age := float64(now - updateDstTime)
+		symbolUpdateAge.Set(age, symbol)
+		symbolUpdateAgeRatio.Set(age/float64(config.policyOf(symbol).maximumDelay), symbol)
+	}
+}
+
+// metrics are process wide, so gauges of a symbol are shared by every App feeding it
+var fedSymbols = struct {
+	sync.Mutex
+	apps map[string]int
+}{apps: make(map[string]int)}
+
+// feedSymbolMetrics counts one more App feeding symbol, see forgetSymbolMetrics.
+func feedSymbolMetrics(symbol string) {
+	fedSymbols.Lock()
+	defer fedSymbols.Unlock()
+	fedSymbols.apps[symbol]++
+}
+
+// forgetSymbolMetrics counts one less App feeding symbol and removes its gauges
+// once no App feeds it any more, counters are kept since they are cumulative.
+func forgetSymbolMetrics(symbol string) {
+	fedSymbols.Lock()
+	defer fedSymbols.Unlock()
+	fedSymbols.apps[symbol]--
+	if fedSymbols.apps[symbol] > 0 {
+		return
+	}
+	delete(fedSymbols.apps, symbol)
+
+	symbolLastPrice.Delete(symbol)
+	symbolDeviationRatio.Delete(symbol)
+	symbolUpdateAge.Delete(symbol)
+	symbolUpdateAgeRatio.Delete(symbol)
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NuttapolCha/test-band-data-feeder/metrics"
+)
+
+// requestCount scrapes how many requests to the host of endpoint have been responded with code.
+func requestCount(t *testing.T, endpoint, method string, code int) float64 {
+	t.Helper()
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		t.Fatalf("invalid endpoint %q: %v", endpoint, err)
+	}
+
+	var buf bytes.Buffer
+	metrics.DefaultRegistry.Expose(&buf)
+	prefix := fmt.Sprintf(`http_client_requests_total{host=%q,method=%q,code="%d"} `, u.Host, method, code)
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		if val := strings.TrimPrefix(scanner.Text(), prefix); val != scanner.Text() {
+			f, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				t.Fatalf("invalid sample %q: %v", scanner.Text(), err)
+			}
+			return f
+		}
+	}
+	return 0
+}
+
+func TestFeedCountsRequests(t *testing.T) {
+	t.Parallel()
+	ft := newFeederTest(t, nil, nil)
+	ft.source.setPrice("BTC", "40000")
+	ft.source.setPrice("ETH", "3000")
+	config := ft.app.getFeederConfig()
+
+	ft.feed()
+	if n := requestCount(t, config.requestPricingDataEndpoint, "POST", 200); n != 1 {
+		t.Errorf("%v requests to data source are counted after a cycle, want 1", n)
+	}
+	if n := requestCount(t, config.updatePricingDataEndpoint, "POST", 200); n != 1 {
+		t.Errorf("%v updates to destination are counted after a cycle, want 1", n)
+	}
+
+	ft.clock.Advance(10 * time.Second)
+	ft.source.setPrice("BTC", "48000")
+	ft.feed()
+	if n := requestCount(t, config.requestPricingDataEndpoint, "POST", 200); n != 2 {
+		t.Errorf("%v requests to data source are counted after two cycles, want 2", n)
+	}
+	if n := requestCount(t, config.updatePricingDataEndpoint, "POST", 200); n != 2 {
+		t.Errorf("%v updates to destination are counted after two cycles, want 2", n)
+	}
+}
@@ -0,0 +1,149 @@
+package pricing
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// maxDecimalPlaces bounds the decimal representation of non-terminating prices (e.g. 1/3)
+const maxDecimalPlaces = 30
+
+// Price is an exact decimal price backed by a rational number.
+// It is immutable, the zero value is price 0.
+type Price struct {
+	r *big.Rat
+}
+
+// ParsePrice parses decimal (e.g. "123.45", "1e-3") or fraction (e.g. "1/3") string.
+func ParsePrice(s string) (Price, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return Price{}, fmt.Errorf("invalid price %q", s)
+	}
+	return Price{r: r}, nil
+}
+
+// NewPriceFromMultiplied returns px / multiplier, both are decimal strings.
+func NewPriceFromMultiplied(px, multiplier string) (Price, error) {
+	multipliedPrice, err := ParsePrice(px)
+	if err != nil {
+		return Price{}, fmt.Errorf("invalid px: %w", err)
+	}
+	m, err := ParsePrice(multiplier)
+	if err != nil {
+		return Price{}, fmt.Errorf("invalid multiplier: %w", err)
+	}
+	if m.Sign() == 0 {
+		return Price{}, fmt.Errorf("multiplier must not be zero")
+	}
+	return Price{r: new(big.Rat).Quo(multipliedPrice.rat(), m.rat())}, nil
+}
+
+// PriceFromFloat converts f using its shortest decimal representation,
+// i.e. 0.1 becomes exactly 1/10 rather than its binary approximation.
+func PriceFromFloat(f float64) Price {
+	p, err := ParsePrice(strconv.FormatFloat(f, 'g', -1, 64))
+	if err != nil {
+		// NaN and Inf
+		return Price{}
+	}
+	return p
+}
+
+func (p Price) rat() *big.Rat {
+	if p.r == nil {
+		return new(big.Rat)
+	}
+	return p.r
+}
+
+// Cmp returns -1, 0 or +1 if p is less than, equal to or greater than q.
+func (p Price) Cmp(q Price) int {
+	return p.rat().Cmp(q.rat())
+}
+
+// Sign returns -1, 0 or +1 if p is negative, zero or positive.
+func (p Price) Sign() int {
+	return p.rat().Sign()
+}
+
+// Sub returns p - q.
+func (p Price) Sub(q Price) Price {
+	return Price{r: new(big.Rat).Sub(p.rat(), q.rat())}
+}
+
+// Abs returns |p|.
+func (p Price) Abs() Price {
+	return Price{r: new(big.Rat).Abs(p.rat())}
+}
+
+// Quo returns p / q, q must not be zero.
+func (p Price) Quo(q Price) Price {
+	return Price{r: new(big.Rat).Quo(p.rat(), q.rat())}
+}
+
+// DiffRatio returns |p - prev| / p, it is zero if p is zero.
+func (p Price) DiffRatio(prev Price) Price {
+	if p.Sign() == 0 {
+		return Price{}
+	}
+	return p.Sub(prev).Abs().Quo(p)
+}
+
+// Round rounds p to the given decimal places, halves are rounded away from zero.
+func (p Price) Round(places int) Price {
+	if places < 0 {
+		places = 0
+	}
+	rounded, _ := new(big.Rat).SetString(p.rat().FloatString(places))
+	return Price{r: rounded}
+}
+
+// Float64 returns the nearest float64 value of p, it is meant for logging and metrics only.
+func (p Price) Float64() float64 {
+	f, _ := p.rat().Float64()
+	return f
+}
+
+// String returns the shortest exact decimal representation of p,
+// non-terminating decimals are rounded to 30 decimal places.
+func (p Price) String() string {
+	r := p.rat()
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	s := r.FloatString(maxDecimalPlaces)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// MarshalJSON encodes p as a JSON number without losing precision.
+func (p Price) MarshalJSON() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalJSON decodes p from either JSON number or JSON string.
+func (p *Price) UnmarshalJSON(bs []byte) error {
+	bs = bytes.TrimSpace(bs)
+	if bytes.Equal(bs, []byte("null")) {
+		*p = Price{}
+		return nil
+	}
+	if len(bs) >= 2 && bs[0] == '"' {
+		unquoted, err := strconv.Unquote(string(bs))
+		if err != nil {
+			return err
+		}
+		bs = []byte(unquoted)
+	}
+
+	parsed, err := ParsePrice(string(bs))
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
@@ -2,12 +2,12 @@ package pricing
 
 type Information interface {
 	GetSymbol() string
-	GetPrice() float64
+	GetPrice() Price
 	GetTimestamp() int64
 }
 
 func Equal(x, y Information) bool {
 	return x.GetSymbol() == y.GetSymbol() &&
-		x.GetPrice() == y.GetPrice() &&
+		x.GetPrice().Cmp(y.GetPrice()) == 0 &&
 		x.GetTimestamp() == y.GetTimestamp()
 }
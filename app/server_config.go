@@ -0,0 +1,35 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+type ServerConfig struct {
+	// listen address of status server exposing metrics and health, empty disables the server
+	listenAddress string
+
+	// liveness fails if no feeding cycle has completed within this many intervals
+	// or this many cycles have failed in a row
+	maxMissedIntervals int
+}
+
+// loadServerConfig reads server config from v.
+func loadServerConfig(v *viper.Viper) *ServerConfig {
+	config := &ServerConfig{
+		listenAddress:      v.GetString("Server.ListenAddress"),
+		maxMissedIntervals: v.GetInt("Server.Health.MaxMissedIntervals"),
+	}
+	if config.maxMissedIntervals == 0 {
+		config.maxMissedIntervals = 3
+	}
+	return config
+}
+
+func (c *ServerConfig) describe() map[string]string {
+	return map[string]string{
+		"Server.ListenAddress":             c.listenAddress,
+		"Server.Health.MaxMissedIntervals": fmt.Sprint(c.maxMissedIntervals),
+	}
+}
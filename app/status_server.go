@@ -0,0 +1,63 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/NuttapolCha/test-band-data-feeder/metrics"
+)
+
+// serveStatus serves metrics, liveness (/healthz) and readiness (/readyz)
+// at the configured listen address until ctx is done, an error is returned if it cannot listen there.
+// The returned channel is closed after the server has been shut down.
+func (app *App) serveStatus(ctx context.Context, config *ServerConfig) (<-chan struct{}, error) {
+	logger := app.logger
+	stopped := make(chan struct{})
+
+	if config.listenAddress == "" {
+		logger.Infof("status server is disabled")
+		close(stopped)
+		return stopped, nil
+	}
+
+	// listen first so that a taken address fails starting rather than being logged only
+	listener, err := net.Listen("tcp", config.listenAddress)
+	if err != nil {
+		return nil, fmt.Errorf("could not listen at %s for status server because: %w", config.listenAddress, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", app.livenessHandler(config))
+	mux.Handle("/readyz", app.readinessHandler())
+
+	server := &http.Server{
+		Addr:              config.listenAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		defer close(stopped)
+
+		logger.Infof("status server is listening at %s", listener.Addr())
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("status server has stopped because: %v", err)
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Errorf("could not shutdown status server gracefully because: %v", err)
+		}
+	}()
+
+	return stopped, nil
+}
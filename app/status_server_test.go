@@ -0,0 +1,23 @@
+package app
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestStatusServerAddressTaken(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer l.Close()
+
+	ft := newFeederTest(t, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := ft.app.serveStatus(ctx, &ServerConfig{listenAddress: l.Addr().String()}); err == nil {
+		t.Errorf("status server is served at %s taken already, want an error", l.Addr())
+	}
+}
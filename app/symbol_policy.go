@@ -0,0 +1,148 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// SymbolPolicy tells when pricing of a symbol needs to be updated to destination.
+type SymbolPolicy struct {
+	symbol string
+
+	// update immediately if price differs from the latest destination price more than this ratio
+	diffThreshold float64
+
+	// update if destination has not been updated longer than this many seconds
+	maximumDelay int64
+
+	// never update destination more often than this many seconds, zero means no limit
+	minUpdateInterval int64
+
+	// price difference must be observed in this many consecutive feedings to be updated immediately
+	confirmationCount int
+
+	// decimal places of prices sent to destination
+	pricePrecision int
+}
+
+// parseSymbolPolicies parses DataFeeder.Symbols which is a list of either
+// symbol names or objects overriding the global defaults, e.g.
+//
+//	Symbols:
+//	  - "BTC"
+//	  - Symbol: "UST"
+//	    DiffThreshold: 0.005
+//
+// A comma separated string of symbols is accepted as well.
+func parseSymbolPolicies(raw interface{}, defaults SymbolPolicy) ([]*SymbolPolicy, error) {
+	var items []interface{}
+	switch v := raw.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		for _, symbol := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' }) {
+			items = append(items, symbol)
+		}
+	case []string:
+		for _, symbol := range v {
+			items = append(items, symbol)
+		}
+	case []interface{}:
+		items = v
+	default:
+		return nil, fmt.Errorf("symbols must be a list but got %T", raw)
+	}
+
+	policies := make([]*SymbolPolicy, 0, len(items))
+	seen := make(map[string]bool, len(items))
+	for i, item := range items {
+		policy := defaults
+
+		if symbol, ok := item.(string); ok {
+			policy.symbol = symbol
+		} else {
+			m, err := cast.ToStringMapE(item)
+			if err != nil {
+				return nil, fmt.Errorf("symbols[%d] must be either a symbol or an object but got %T", i, item)
+			}
+			if err := policy.override(m); err != nil {
+				return nil, fmt.Errorf("symbols[%d]: %w", i, err)
+			}
+		}
+
+		policy.symbol = strings.ToUpper(strings.TrimSpace(policy.symbol))
+		if policy.symbol == "" {
+			return nil, fmt.Errorf("symbols[%d]: symbol is required", i)
+		}
+		if seen[policy.symbol] {
+			return nil, fmt.Errorf("symbols[%d]: symbol %s is duplicated", i, policy.symbol)
+		}
+		seen[policy.symbol] = true
+
+		policies = append(policies, &policy)
+	}
+	return policies, nil
+}
+
+// override sets fields found in m, keys are case insensitive.
+func (p *SymbolPolicy) override(m map[string]interface{}) error {
+	for key, val := range m {
+		var err error
+		switch strings.ToLower(key) {
+		case "symbol":
+			p.symbol, err = cast.ToStringE(val)
+		case "diffthreshold":
+			p.diffThreshold, err = cast.ToFloat64E(val)
+		case "maximumdelay":
+			var i int
+			i, err = integer(val)
+			p.maximumDelay = int64(i)
+		case "minupdateinterval":
+			var i int
+			i, err = integer(val)
+			p.minUpdateInterval = int64(i)
+		case "confirmationcount":
+			p.confirmationCount, err = integer(val)
+		case "priceprecision":
+			p.pricePrecision, err = integer(val)
+		default:
+			return fmt.Errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// validate rejects policies the feeder cannot work with.
+func (p *SymbolPolicy) validate() error {
+	if p.diffThreshold <= 0 {
+		return fmt.Errorf("DiffThreshold must be positive but got %v", p.diffThreshold)
+	}
+	if p.maximumDelay <= 0 {
+		return fmt.Errorf("MaximumDelay must be positive but got %v", p.maximumDelay)
+	}
+	if p.minUpdateInterval < 0 {
+		return fmt.Errorf("MinUpdateInterval must not be negative but got %v", p.minUpdateInterval)
+	}
+	if p.confirmationCount < 1 {
+		return fmt.Errorf("ConfirmationCount must be at least 1 but got %v", p.confirmationCount)
+	}
+	if p.pricePrecision < 0 {
+		return fmt.Errorf("PricePrecision must not be negative but got %v", p.pricePrecision)
+	}
+	return nil
+}
+
+func (p *SymbolPolicy) describe() map[string]string {
+	return map[string]string{
+		"DiffThreshold":     fmt.Sprint(p.diffThreshold),
+		"MaximumDelay":      fmt.Sprint(p.maximumDelay),
+		"MinUpdateInterval": fmt.Sprint(p.minUpdateInterval),
+		"ConfirmationCount": fmt.Sprint(p.confirmationCount),
+		"PricePrecision":    fmt.Sprint(p.pricePrecision),
+	}
+}
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/spf13/viper"
@@ -8,18 +9,58 @@ import (
 
 type TimeConfig struct {
 	interval time.Duration
+
+	// hard deadline of each feeding cycle
+	cycleTimeout time.Duration
+}
+
+// getTimeConfig returns the current time config, it is swapped as a whole on reload.
+func (app *App) getTimeConfig() *TimeConfig {
+	return app.timeConfig.Load().(*TimeConfig)
+}
+
+// loadTimeConfig reads and validates time config from v.
+func loadTimeConfig(v *viper.Viper) (*TimeConfig, error) {
+	config := readTimeConfig(v)
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
 }
 
-var timeConfig *TimeConfig
+// readTimeConfig reads time config from v with defaults applied.
+func readTimeConfig(v *viper.Viper) *TimeConfig {
+	config := &TimeConfig{
+		interval:     getSeconds(v, "DataFeeder.Interval"),
+		cycleTimeout: getSeconds(v, "DataFeeder.CycleTimeout"),
+	}
+	if config.interval == 0 {
+		config.interval = 10 * time.Second
+	}
+	if config.cycleTimeout == 0 {
+		// leave the rest of the interval for the cycle to wind down before the next one
+		config.cycleTimeout = config.interval * 4 / 5
+	}
+	return config
+}
+
+// validate rejects values the feeder cannot work with.
+func (c *TimeConfig) validate() error {
+	if c.interval < 0 {
+		return fmt.Errorf("invalid DataFeeder.Interval: must be positive but got %v", c.interval)
+	}
+	if c.cycleTimeout < 0 {
+		return fmt.Errorf("invalid DataFeeder.CycleTimeout: must be positive but got %v", c.cycleTimeout)
+	}
+	if c.cycleTimeout >= c.interval {
+		return fmt.Errorf("invalid DataFeeder.CycleTimeout: must be less than DataFeeder.Interval %v but got %v", c.interval, c.cycleTimeout)
+	}
+	return nil
+}
 
-func getTimeConfig() *TimeConfig {
-	if timeConfig == nil {
-		timeConfig = &TimeConfig{
-			interval: viper.GetDuration("DataFeeder.Interval") * time.Second,
-		}
-		if timeConfig.interval == 0 {
-			timeConfig.interval = 10 * time.Second
-		}
+func (c *TimeConfig) describe() map[string]string {
+	return map[string]string{
+		"DataFeeder.Interval":     c.interval.String(),
+		"DataFeeder.CycleTimeout": c.cycleTimeout.String(),
 	}
-	return timeConfig
 }
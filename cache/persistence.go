@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/NuttapolCha/test-band-data-feeder/app/pricing"
+)
+
+// pricingRecord is a single line of the append-only cache file.
+// The last record of each symbol wins when the file is replayed.
+type pricingRecord struct {
+	Symbol        string        `json:"symbol"`
+	Price         pricing.Price `json:"price"`
+	UpdateDstTime int64         `json:"update_dst_time"`
+	DstTime       int64         `json:"dst_time"`
+}
+
+// Restore loads the latest pricing of every symbol from the file at path
+// into the store and keeps the file open so that every UpdatePricing is written through.
+// The file is compacted to one record per symbol while restoring.
+// It returns the number of restored symbols.
+func (ltsp *LatestPricing) Restore(path string) (int, error) {
+	ltsp.mu.Lock()
+	defer ltsp.mu.Unlock()
+
+	if ltsp.file != nil {
+		return 0, fmt.Errorf("cache has already been restored from %s", ltsp.file.Name())
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+
+	restored, err := readRecords(path)
+	if err != nil {
+		return 0, err
+	}
+	for symbol, record := range restored {
+		ltsp.m[symbol] = &pricingWithTimestamp{
+			symbol:        record.Symbol,
+			price:         record.Price,
+			updateDstTime: record.UpdateDstTime,
+			dstTime:       record.DstTime,
+		}
+	}
+
+	// rewrite the whole cache so the file does not grow forever
+	if err := compact(path, ltsp.m); err != nil {
+		return 0, err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	ltsp.file = f
+
+	return len(restored), nil
+}
+
+// Close closes the backing file, if any. The in-memory store is still usable afterwards.
+func (ltsp *LatestPricing) Close() error {
+	ltsp.mu.Lock()
+	defer ltsp.mu.Unlock()
+
+	if ltsp.file == nil {
+		return nil
+	}
+	err := ltsp.file.Close()
+	ltsp.file = nil
+	return err
+}
+
+func readRecords(path string) (map[string]*pricingRecord, error) {
+	records := make(map[string]*pricingRecord)
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// a torn write can only be at the tail of the file, it is skipped rather than refusing to start.
+	// A corrupt record followed by any other is not a torn write so the file is refused.
+	var corrupt error
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if corrupt != nil {
+			return nil, corrupt
+		}
+		record := &pricingRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			corrupt = fmt.Errorf("invalid cache record at %s:%d: %v", path, line, err)
+			continue
+		}
+		if record.Symbol == "" {
+			return nil, fmt.Errorf("invalid cache record at %s:%d: empty symbol", path, line)
+		}
+		records[record.Symbol] = record
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func compact(path string, m symbolMapPricing) error {
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, p := range m {
+		if err := writeRecord(w, p); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+func writeRecord(w io.Writer, p *pricingWithTimestamp) error {
+	bs, err := json.Marshal(&pricingRecord{
+		Symbol:        p.symbol,
+		Price:         p.price,
+		UpdateDstTime: p.updateDstTime,
+		DstTime:       p.dstTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(bs, '\n'))
+	return err
+}
@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/NuttapolCha/test-band-data-feeder/app/pricing"
+)
+
+func writeCacheFile(t *testing.T, path string, lines ...string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatalf("could not write cache file: %v", err)
+	}
+}
+
+func cacheLines(t *testing.T, path string) []string {
+	t.Helper()
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read cache file: %v", err)
+	}
+	return strings.Split(strings.TrimSuffix(string(bs), "\n"), "\n")
+}
+
+func expectPricing(t *testing.T, store *LatestPricing, symbol, price string, updateDstTime, dstTime int64) {
+	t.Helper()
+	p, err := store.GetPricing(symbol)
+	if err != nil {
+		t.Errorf("%s: %v", symbol, err)
+		return
+	}
+	if got := p.GetPrice().String(); got != price || p.GetTimestamp() != dstTime {
+		t.Errorf("%s: %s @%d, want %s @%d", symbol, got, p.GetTimestamp(), price, dstTime)
+	}
+	if got, _ := store.GetPrevUpdatedDstTime(symbol); got != updateDstTime {
+		t.Errorf("%s: destination updated at %d, want %d", symbol, got, updateDstTime)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "pricing.jsonl")
+
+	// nothing to restore on the first start, the directory is created
+	store := NewLatestPricing()
+	if n, err := store.Restore(path); err != nil || n != 0 {
+		t.Fatalf("restored %d symbols from a missing file: %v", n, err)
+	}
+	if err := store.UpdatePricing("BTC", pricing.PriceFromFloat(40000), 100, 90); err != nil {
+		t.Fatalf("could not update pricing: %v", err)
+	}
+	if err := store.UpdatePricing("ETH", pricing.PriceFromFloat(3000.5), 100, 90); err != nil {
+		t.Fatalf("could not update pricing: %v", err)
+	}
+	if err := store.UpdatePricing("BTC", pricing.PriceFromFloat(41000), 200, 190); err != nil {
+		t.Fatalf("could not update pricing: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("could not close cache: %v", err)
+	}
+
+	// the last record of each symbol wins
+	store = NewLatestPricing()
+	defer store.Close()
+	if n, err := store.Restore(path); err != nil || n != 2 {
+		t.Fatalf("restored %d symbols: %v, want 2", n, err)
+	}
+	expectPricing(t, store, "BTC", "41000", 200, 190)
+	expectPricing(t, store, "ETH", "3000.5", 100, 90)
+
+	if _, err := store.Restore(path); err == nil {
+		t.Errorf("cache is restored twice, want an error")
+	}
+}
+
+func TestRestoreCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pricing.jsonl")
+	writeCacheFile(t, path,
+		`{"symbol":"BTC","price":40000,"update_dst_time":100,"dst_time":90}`,
+		`{"symbol":"BTC","price":41000,"update_dst_time":200,"dst_time":190}`,
+		`{"symbol":"ETH","price":3000,"update_dst_time":100,"dst_time":90}`,
+		`{"symbol":"BTC","price":42000,"update_dst_time":300,"dst_time":290}`,
+	)
+
+	store := NewLatestPricing()
+	defer store.Close()
+	if _, err := store.Restore(path); err != nil {
+		t.Fatalf("could not restore: %v", err)
+	}
+	if lines := cacheLines(t, path); len(lines) != 2 {
+		t.Errorf("%d records after compaction, want one per symbol:\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file of compaction is left behind: %v", err)
+	}
+
+	// updates are appended to the compacted file
+	if err := store.UpdatePricing("ETH", pricing.PriceFromFloat(3100), 400, 390); err != nil {
+		t.Fatalf("could not update pricing: %v", err)
+	}
+	if lines := cacheLines(t, path); len(lines) != 3 {
+		t.Errorf("%d records after an update, want 3", len(lines))
+	}
+}
+
+func TestRestoreTornLastRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pricing.jsonl")
+	writeCacheFile(t, path,
+		`{"symbol":"BTC","price":40000,"update_dst_time":100,"dst_time":90}`,
+		`{"symbol":"ETH","price":3000,"update_dst_time":100,"dst_time":90}`,
+		`{"symbol":"BTC","price":410`,
+	)
+
+	store := NewLatestPricing()
+	defer store.Close()
+	if n, err := store.Restore(path); err != nil || n != 2 {
+		t.Fatalf("restored %d symbols: %v, want 2 skipping the torn record", n, err)
+	}
+	expectPricing(t, store, "BTC", "40000", 100, 90)
+	// the torn record is dropped by compaction
+	if lines := cacheLines(t, path); len(lines) != 2 {
+		t.Errorf("%d records after compaction, want 2:\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+}
+
+func TestRestoreCorruptRecord(t *testing.T) {
+	tests := map[string][]string{
+		"corrupt record in the middle": {
+			`{"symbol":"BTC","price":40000,"update_dst_time":100,"dst_time":90}`,
+			`not a record`,
+			`{"symbol":"ETH","price":3000,"update_dst_time":100,"dst_time":90}`,
+		},
+		"empty symbol": {
+			`{"symbol":"","price":40000,"update_dst_time":100,"dst_time":90}`,
+		},
+	}
+	for name, lines := range tests {
+		path := filepath.Join(t.TempDir(), "pricing.jsonl")
+		writeCacheFile(t, path, lines...)
+
+		store := NewLatestPricing()
+		if _, err := store.Restore(path); err == nil {
+			t.Errorf("%s: cache is restored, want an error", name)
+		}
+		store.Close()
+
+		// the file is left as it is for investigation
+		if got := cacheLines(t, path); strings.Join(got, "\n") != strings.Join(lines, "\n") {
+			t.Errorf("%s: file is rewritten:\n%s", name, strings.Join(got, "\n"))
+		}
+	}
+}
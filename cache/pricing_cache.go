@@ -2,7 +2,10 @@ package cache
 
 import (
 	"fmt"
+	"os"
 	"sync"
+
+	"github.com/NuttapolCha/test-band-data-feeder/app/pricing"
 )
 
 // we might call pricingWithTimestamp a virtual database of this service
@@ -10,7 +13,7 @@ type pricingWithTimestamp struct {
 	symbol string
 
 	// price is the latest price we known at destination
-	price float64
+	price pricing.Price
 
 	// updateDstTime is a time at which we called for update destination service
 	updateDstTime int64
@@ -24,7 +27,7 @@ func (p *pricingWithTimestamp) GetSymbol() string {
 	return p.symbol
 }
 
-func (p *pricingWithTimestamp) GetPrice() float64 {
+func (p *pricingWithTimestamp) GetPrice() pricing.Price {
 	return p.price
 }
 
@@ -34,22 +37,40 @@ func (p *pricingWithTimestamp) GetTimestamp() int64 {
 
 type symbolMapPricing map[string]*pricingWithTimestamp
 
+// PricingStore keeps the latest pricing sent to destination of every symbol.
+type PricingStore interface {
+	// GetPricing returns the latest pricing of symbol, its timestamp is the one sent to destination
+	GetPricing(symbol string) (pricing.Information, error)
+
+	// GetPrevUpdatedDstTime returns the time at which destination was updated with the latest pricing of symbol
+	GetPrevUpdatedDstTime(symbol string) (int64, error)
+
+	UpdatePricing(symbol string, price pricing.Price, updateDstTime, dstTime int64) error
+
+	// Restore loads the latest pricing from the file at path and keeps writing through to it
+	Restore(path string) (int, error)
+
+	Close() error
+}
+
+// LatestPricing is a PricingStore kept in memory, optionally backed by an append-only file.
 type LatestPricing struct {
 	mu sync.Mutex
 	m  symbolMapPricing
-}
 
-var ltsp LatestPricing
+	// file is the append-only backing store, nil means in-memory only
+	file *os.File
+}
 
-func init() {
-	ltsp = LatestPricing{
-		mu: sync.Mutex{},
-		m:  make(symbolMapPricing),
+// NewLatestPricing returns an empty in-memory store, see Restore for persisting it.
+func NewLatestPricing() *LatestPricing {
+	return &LatestPricing{
+		m: make(symbolMapPricing),
 	}
 }
 
-// GetPrevPrice return pricing
-func GetPricing(symbol string) (*pricingWithTimestamp, error) {
+// GetPricing return pricing
+func (ltsp *LatestPricing) GetPricing(symbol string) (pricing.Information, error) {
 	ltsp.mu.Lock()
 	defer ltsp.mu.Unlock()
 
@@ -61,7 +82,7 @@ func GetPricing(symbol string) (*pricingWithTimestamp, error) {
 	return pricing, nil
 }
 
-func GetPrevUpdatedDstTime(symbol string) (int64, error) {
+func (ltsp *LatestPricing) GetPrevUpdatedDstTime(symbol string) (int64, error) {
 	ltsp.mu.Lock()
 	defer ltsp.mu.Unlock()
 
@@ -73,22 +94,33 @@ func GetPrevUpdatedDstTime(symbol string) (int64, error) {
 	return pricing.updateDstTime, nil
 }
 
-func UpdatePricing(
+// UpdatePricing updates the latest pricing of symbol and writes it through to the backing file if restored.
+// The in-memory cache is always updated even if writing to the file failed.
+func (ltsp *LatestPricing) UpdatePricing(
 	symbol string,
-	price float64,
+	price pricing.Price,
 	updateDstTime,
 	dstTime int64,
-) {
+) error {
 	if symbol == "" {
 		panic("cannot update with empty string key")
 	}
 	ltsp.mu.Lock()
 	defer ltsp.mu.Unlock()
 
-	ltsp.m[symbol] = &pricingWithTimestamp{
+	p := &pricingWithTimestamp{
 		symbol:        symbol,
 		price:         price,
 		updateDstTime: updateDstTime,
 		dstTime:       dstTime,
 	}
+	ltsp.m[symbol] = p
+
+	if ltsp.file == nil {
+		return nil
+	}
+	if err := writeRecord(ltsp.file, p); err != nil {
+		return fmt.Errorf("could not write %s pricing to %s: %w", symbol, ltsp.file.Name(), err)
+	}
+	return nil
 }
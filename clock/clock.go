@@ -0,0 +1,72 @@
+// Package clock abstracts time away from time based decisions,
+// so they can be simulated in tests instead of waited for.
+package clock
+
+import (
+	"context"
+	"time"
+)
+
+// Clock tells the current time and waits for time to pass.
+type Clock interface {
+	Now() time.Time
+
+	// After waits for d to pass and then sends the current time on the returned channel.
+	After(d time.Duration) <-chan time.Time
+
+	// NewTicker returns a ticker ticking every d, d must be positive.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks at intervals like time.Ticker,
+// ticks are dropped if the receiver is not keeping up.
+type Ticker interface {
+	C() <-chan time.Time
+	Reset(d time.Duration)
+	Stop()
+}
+
+// Sleep pauses for d on clk or until ctx is done, whichever comes first.
+func Sleep(ctx context.Context, clk Clock, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-clk.After(d):
+		return nil
+	}
+}
+
+// New returns the wall clock backed by the time package.
+func New() Clock {
+	return realClock{}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return &realTicker{ticker: time.NewTicker(d)}
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t *realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t *realTicker) Reset(d time.Duration) {
+	t.ticker.Reset(d)
+}
+
+func (t *realTicker) Stop() {
+	t.ticker.Stop()
+}
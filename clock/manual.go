@@ -0,0 +1,154 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Manual is a simulated clock for tests, its time stands still until it is advanced.
+// Sleeping on it with After lasts until the clock is advanced past the wake-up time,
+// so the test decides when and by how much time passes.
+type Manual struct {
+	mu       sync.Mutex
+	changed  *sync.Cond
+	now      time.Time
+	tickers  []*manualTicker
+	sleepers []*manualSleeper
+}
+
+type manualSleeper struct {
+	until time.Time
+	c     chan time.Time
+}
+
+// NewManual returns a simulated clock starting at t.
+func NewManual(t time.Time) *Manual {
+	c := &Manual{now: t}
+	c.changed = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *Manual) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d, every ticker due ticks once and every sleeper due wakes up.
+func (c *Manual) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	for _, t := range c.tickers {
+		if c.now.Before(t.next) {
+			continue
+		}
+		select {
+		case t.c <- c.now:
+		default:
+		}
+		for !c.now.Before(t.next) {
+			t.next = t.next.Add(t.period)
+		}
+	}
+
+	sleeping := c.sleepers[:0]
+	for _, s := range c.sleepers {
+		if c.now.Before(s.until) {
+			sleeping = append(sleeping, s)
+			continue
+		}
+		s.c <- c.now
+	}
+	c.sleepers = sleeping
+}
+
+// After returns a channel receiving the time once the clock has been advanced by d.
+func (c *Manual) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.sleepers = append(c.sleepers, &manualSleeper{until: c.now.Add(d), c: ch})
+	c.changed.Broadcast()
+	return ch
+}
+
+func (c *Manual) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &manualTicker{
+		clock:  c,
+		c:      make(chan time.Time, 1),
+		period: d,
+		next:   c.now.Add(d),
+	}
+	c.tickers = append(c.tickers, t)
+	c.changed.Broadcast()
+	return t
+}
+
+// BlockUntilTickers blocks until n tickers are running,
+// so the test does not advance the clock before the code under test has started ticking.
+func (c *Manual) BlockUntilTickers(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.tickers) < n {
+		c.changed.Wait()
+	}
+}
+
+// BlockUntilSleepers blocks until n sleepers are waiting for the clock to be advanced,
+// a sleeper given up on by its caller is still waiting until the clock passes its wake-up time.
+func (c *Manual) BlockUntilSleepers(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.sleepers) < n {
+		c.changed.Wait()
+	}
+}
+
+type manualTicker struct {
+	clock  *Manual
+	c      chan time.Time
+	period time.Duration
+	next   time.Time
+}
+
+func (t *manualTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("non-positive interval for Ticker.Reset")
+	}
+
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.period = d
+	t.next = t.clock.now.Add(d)
+}
+
+func (t *manualTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	for i, running := range t.clock.tickers {
+		if running == t {
+			t.clock.tickers = append(t.clock.tickers[:i], t.clock.tickers[i+1:]...)
+			break
+		}
+	}
+	t.clock.changed.Broadcast()
+}
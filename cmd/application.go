@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/NuttapolCha/test-band-data-feeder/app"
+	"github.com/NuttapolCha/test-band-data-feeder/cache"
+	"github.com/NuttapolCha/test-band-data-feeder/clock"
+	"github.com/NuttapolCha/test-band-data-feeder/connector"
+	"github.com/NuttapolCha/test-band-data-feeder/log"
+)
+
+// newApplication wires the application up with the config from viper which is watched for changes,
+// an empty pricing cache, the wall clock and an HTTP client.
+func newApplication(ctx context.Context, logger log.Logger) (*app.App, error) {
+	// refuse to start with config that would silently fall back to defaults
+	check := configSource.Check()
+	for _, warning := range check.Warnings {
+		logger.Warnf("config: %s", warning)
+	}
+	if err := check.Err(); err != nil {
+		return nil, err
+	}
+
+	// checked above already, Load would check it again
+	config, err := app.LoadConfig(configViper)
+	if err != nil {
+		return nil, err
+	}
+	clk := clock.New()
+	return app.New(ctx, logger, config, configSource, cache.NewLatestPricing(), clk, connector.NewCustomHttpClient(logger, configViper, clk)), nil
+}
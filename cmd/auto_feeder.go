@@ -1,8 +1,6 @@
 package cmd
 
 import (
-	"github.com/NuttapolCha/test-band-data-feeder/app"
-	"github.com/NuttapolCha/test-band-data-feeder/connector"
 	"github.com/NuttapolCha/test-band-data-feeder/log"
 	"github.com/spf13/cobra"
 )
@@ -11,16 +9,25 @@ var autoFeederCmd = &cobra.Command{
 	Use:   "auto-feeder",
 	Short: "feeds coins pricing data from data source to destination service",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		logger, err := log.NewLogger()
+		if err := bindOverrideFlags(cmd); err != nil {
+			return err
+		}
+
+		logger, err := log.NewLogger(configViper)
 		if err != nil {
 			panic(err)
 		}
-		httpClient := connector.NewCustomHttpClient(logger)
-		application := app.New(logger, httpClient)
+		defer logger.Close()
+
+		application, err := newApplication(cmd.Context(), logger)
+		if err != nil {
+			return err
+		}
 		return application.StartDataAutomaticFeeder()
 	},
 }
 
 func init() {
+	addOverrideFlags(autoFeederCmd)
 	rootCmd.AddCommand(autoFeederCmd)
 }
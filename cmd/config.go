@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "inspects configuration",
+	}
+
+	configValidateCmd = &cobra.Command{
+		Use:   "validate",
+		Short: "validates configuration and prints the effective configuration with where each value comes from",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			check := configSource.Check()
+			if err := check.WriteTable(os.Stdout); err != nil {
+				return err
+			}
+			if len(check.Problems) > 0 {
+				return fmt.Errorf("config has %d problems", len(check.Problems))
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	configCmd.AddCommand(configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
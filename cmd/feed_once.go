@@ -1,26 +1,59 @@
 package cmd
 
 import (
-	"github.com/NuttapolCha/test-band-data-feeder/app"
-	"github.com/NuttapolCha/test-band-data-feeder/connector"
+	"fmt"
+	"os"
+
 	"github.com/NuttapolCha/test-band-data-feeder/log"
 	"github.com/spf13/cobra"
 )
 
-var feedOne = &cobra.Command{
-	Use:   "feed-once",
-	Short: "feeds coins pricing data from data source to destination service only once",
-	Run: func(cmd *cobra.Command, args []string) {
-		logger, err := log.NewLogger()
-		if err != nil {
-			panic(err)
-		}
-		httpClient := connector.NewCustomHttpClient(logger)
-		application := app.New(logger, httpClient)
-		application.Feed()
-	},
-}
+var (
+	// format of the printed feed report
+	feedOnceOutput string
+
+	feedOne = &cobra.Command{
+		Use:   "feed-once",
+		Short: "feeds coins pricing data from data source to destination service only once",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if feedOnceOutput != "table" && feedOnceOutput != "json" {
+				return fmt.Errorf("unknown output format %q, must be either table or json", feedOnceOutput)
+			}
+
+			if err := bindOverrideFlags(cmd); err != nil {
+				return err
+			}
+
+			logger, err := log.NewLogger(configViper)
+			if err != nil {
+				panic(err)
+			}
+			defer logger.Close()
+
+			application, err := newApplication(cmd.Context(), logger)
+			if err != nil {
+				return err
+			}
+			report := application.Feed()
+
+			if feedOnceOutput == "json" {
+				err = report.WriteJSON(os.Stdout)
+			} else {
+				err = report.WriteTable(os.Stdout)
+			}
+			if err != nil {
+				return err
+			}
+			if report.Failed() {
+				return fmt.Errorf("feeding failed")
+			}
+			return nil
+		},
+	}
+)
 
 func init() {
+	feedOne.Flags().StringVarP(&feedOnceOutput, "output", "o", "table", "feed report format, either table or json")
+	addOverrideFlags(feedOne)
 	rootCmd.AddCommand(feedOne)
 }
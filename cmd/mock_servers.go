@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/NuttapolCha/test-band-data-feeder/log"
+	"github.com/NuttapolCha/test-band-data-feeder/mock"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mockSourceAddress      string
+	mockDestinationAddress string
+	mockSourceConfig       mock.SourceConfig
+	mockScenarioFile       string
+
+	mockServersCmd = &cobra.Command{
+		Use:   "mock-servers",
+		Short: "starts local data source and destination stand-ins, see config/local.yaml to feed them",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logger, err := log.NewLogger(configViper)
+			if err != nil {
+				panic(err)
+			}
+			defer logger.Close()
+
+			// both servers share the injector so that a seed reproduces the whole scenario
+			var faults *mock.FaultInjector
+			if mockScenarioFile != "" {
+				scenario, err := mock.LoadScenario(mockScenarioFile)
+				if err != nil {
+					return err
+				}
+				faults = mock.NewFaultInjector(logger, scenario)
+				logger.Infof("injecting %d faults from %s", len(scenario.Faults), mockScenarioFile)
+			}
+
+			// either server failing stops the other one, there is no point serving half of the stand-ins
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+			stopped := make(chan error, 2)
+			serveMock(ctx, logger, "data source", mockSourceAddress, mock.NewSource(logger, mockSourceConfig, faults), stopped)
+			serveMock(ctx, logger, "destination", mockDestinationAddress, mock.NewDestination(logger, faults), stopped)
+
+			var firstErr error
+			for i := 0; i < 2; i++ {
+				if err := <-stopped; err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+			}
+			return firstErr
+		},
+	}
+)
+
+// serveMock serves handler at addr until ctx is done, stopped receives
+// nil after the server has been shut down or the error it has stopped with.
+func serveMock(ctx context.Context, logger log.Logger, name, addr string, handler http.Handler, stopped chan<- error) {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		logger.Infof("mock %s is listening at %s", name, addr)
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			stopped <- fmt.Errorf("mock %s has stopped because: %w", name, err)
+			return
+		}
+		stopped <- nil
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Errorf("could not shutdown mock %s gracefully because: %v", name, err)
+		}
+	}()
+}
+
+func init() {
+	flags := mockServersCmd.Flags()
+	flags.StringVar(&mockSourceAddress, "source-address", "localhost:8080", "listen address of the mock data source")
+	flags.StringVar(&mockDestinationAddress, "destination-address", "localhost:8081", "listen address of the mock destination")
+	flags.DurationVar(&mockSourceConfig.ResolveDelay, "resolve-delay", 2*time.Second, "requested pricing is pending until this long after it is requested")
+	flags.Int64Var(&mockSourceConfig.Multiplier, "multiplier", 1000000000, "px is price * multiplier")
+	flags.Float64Var(&mockSourceConfig.Volatility, "volatility", 0.05, "every request moves each price by up to this ratio")
+	flags.Int64Var(&mockSourceConfig.Seed, "seed", 0, "seed of the random walk, zero seeds from the current time")
+	flags.StringVar(&mockScenarioFile, "scenario", "", "scenario file of faults to inject, see config/mock_scenario.yaml")
+	rootCmd.AddCommand(mockServersCmd)
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// overrideFlags are flags overriding the most common config keys, keyed by flag name
+var overrideFlags = []struct {
+	name  string
+	key   string
+	usage string
+}{
+	{"symbols", "DataFeeder.Symbols", "comma separated symbols to feed, overrides DataFeeder.Symbols"},
+	{"interval", "DataFeeder.Interval", "seconds between feedings, overrides DataFeeder.Interval"},
+	{"request-pricing-endpoint", "ExternalAPIs.DataSource.RequestPricingData", "data source endpoint requesting pricing"},
+	{"get-pricing-endpoint", "ExternalAPIs.DataSource.GetPricingData", "data source endpoint getting the requested pricing"},
+	{"update-pricing-endpoint", "ExternalAPIs.Destination.UpdatePricingData", "destination endpoint updating pricing"},
+	{"get-updated-pricing-endpoint", "ExternalAPIs.Destination.GetUpdatedPricingData", "destination endpoint getting the updated pricing"},
+	{"log-level", "Log.Level", "either info, debug or verbose, overrides Log.Level"},
+}
+
+// addOverrideFlags adds flags overriding config to cmd, see bindOverrideFlags.
+func addOverrideFlags(cmd *cobra.Command) {
+	for _, f := range overrideFlags {
+		if f.name == "interval" {
+			cmd.Flags().Float64(f.name, 0, f.usage)
+			continue
+		}
+		cmd.Flags().String(f.name, "", f.usage)
+	}
+}
+
+// bindOverrideFlags binds flags of the running cmd to config, it must be called
+// in the command itself since every command has its own flags for the same keys.
+func bindOverrideFlags(cmd *cobra.Command) error {
+	for _, f := range overrideFlags {
+		if err := configSource.BindFlag(f.key, cmd.Flags().Lookup(f.name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/NuttapolCha/test-band-data-feeder/app"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -12,9 +16,18 @@ var (
 	// for custom config file
 	configFile string
 
+	// configViper holds config of every command, the logger, HTTP client and application
+	// are all built from it so flags, env and file apply the same to each of them
+	configViper  = viper.New()
+	configSource = app.NewViperSource(configViper)
+
 	rootCmd = &cobra.Command{
 		Use:   "data-feeder",
 		Short: "this project is only for Band Protocol Interview process.",
+
+		// errors are printed once by Execute, usage is not helpful for runtime errors
+		SilenceErrors: true,
+		SilenceUsage:  true,
 	}
 )
 
@@ -23,9 +36,13 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "config file (default is ./config/config.yaml)")
 }
 
-// Execute executes the root command
+// Execute executes the root command,
+// the command context is cancelled once SIGINT or SIGTERM is received
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -34,18 +51,22 @@ func Execute() {
 func initConfig() {
 	if configFile != "" {
 		// Use config file from the flag.
-		viper.SetConfigFile(configFile)
+		configViper.SetConfigFile(configFile)
 	} else {
 
 		// Search config in home directory with name "config" (without extension).
-		viper.AddConfigPath("./config")
-		viper.SetConfigType("yaml")
-		viper.SetConfigName("config")
+		configViper.AddConfigPath("./config")
+		configViper.SetConfigType("yaml")
+		configViper.SetConfigName("config")
 	}
 
-	viper.AutomaticEnv()
+	// every key can be overridden by environment variable, e.g. DATAFEEDER_DATAFEEDER_INTERVAL
+	if err := configSource.BindEnv(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+	if err := configViper.ReadInConfig(); err == nil {
+		fmt.Println("Using config file:", configViper.ConfigFileUsed())
 	}
 }
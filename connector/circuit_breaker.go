@@ -0,0 +1,206 @@
+package connector
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/NuttapolCha/test-band-data-feeder/clock"
+	"github.com/NuttapolCha/test-band-data-feeder/log"
+)
+
+// ErrCircuitOpen is returned without requesting when the endpoint host is known to be down.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type BreakerState int
+
+const (
+	// BreakerClosed lets every request through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects every request until the cool-down has passed
+	BreakerOpen
+	// BreakerHalfOpen lets a single trial request through to decide whether to close or open again
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// MarshalText makes the state readable in JSON health reports.
+func (s BreakerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+type circuitBreaker struct {
+	logger log.Logger
+	clock  clock.Clock
+	host   string
+
+	// failureThreshold consecutive failures opens the circuit, negative disables the breaker
+	failureThreshold int
+	coolDown         time.Duration
+
+	mu               sync.Mutex
+	state            BreakerState
+	failures         int
+	openedAt         time.Time
+	halfOpenInFlight bool
+}
+
+// allow tells whether a request to the host can be sent now.
+func (b *circuitBreaker) allow() error {
+	if b.failureThreshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.clock.Now().Sub(b.openedAt) < b.coolDown {
+			return ErrCircuitOpen
+		}
+		b.transit(BreakerHalfOpen)
+		b.halfOpenInFlight = true
+		return nil
+	case BreakerHalfOpen:
+		if b.halfOpenInFlight {
+			return ErrCircuitOpen
+		}
+		b.halfOpenInFlight = true
+		return nil
+	}
+	return nil
+}
+
+func (b *circuitBreaker) onSuccess() {
+	if b.failureThreshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.halfOpenInFlight = false
+	if b.state != BreakerClosed {
+		b.transit(BreakerClosed)
+	}
+}
+
+func (b *circuitBreaker) onFailure() {
+	if b.failureThreshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.halfOpenInFlight = false
+	switch b.state {
+	case BreakerHalfOpen:
+		b.openedAt = b.clock.Now()
+		b.transit(BreakerOpen)
+	case BreakerClosed:
+		if b.failures >= b.failureThreshold {
+			b.openedAt = b.clock.Now()
+			b.transit(BreakerOpen)
+		}
+	}
+}
+
+// onCancel releases the half-open trial without judging the host.
+func (b *circuitBreaker) onCancel() {
+	if b.failureThreshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.halfOpenInFlight = false
+}
+
+func (b *circuitBreaker) getState() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// transit must be called while holding the lock
+func (b *circuitBreaker) transit(to BreakerState) {
+	logger := b.logger
+
+	from := b.state
+	b.state = to
+	breakerState.Set(float64(to), b.host)
+	switch to {
+	case BreakerOpen:
+		logger.Warnf("CIRCUIT BREAKER: %s is %s after %d consecutive failures (was %s), requests are skipped for %v", b.host, to, b.failures, from, b.coolDown)
+	case BreakerHalfOpen:
+		logger.Infof("CIRCUIT BREAKER: %s is %s (was %s), trying a request", b.host, to, from)
+	default:
+		logger.Infof("CIRCUIT BREAKER: %s is %s (was %s)", b.host, to, from)
+	}
+}
+
+// breakers keeps one circuit breaker per host.
+type breakers struct {
+	logger           log.Logger
+	clock            clock.Clock
+	failureThreshold int
+	coolDown         time.Duration
+
+	mu sync.Mutex
+	m  map[string]*circuitBreaker
+}
+
+func newBreakers(logger log.Logger, clk clock.Clock, failureThreshold int, coolDown time.Duration) *breakers {
+	return &breakers{
+		logger:           logger,
+		clock:            clk,
+		failureThreshold: failureThreshold,
+		coolDown:         coolDown,
+		m:                make(map[string]*circuitBreaker),
+	}
+}
+
+func (bs *breakers) get(host string) *circuitBreaker {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	b, ok := bs.m[host]
+	if !ok {
+		b = &circuitBreaker{
+			logger:           bs.logger,
+			clock:            bs.clock,
+			host:             host,
+			failureThreshold: bs.failureThreshold,
+			coolDown:         bs.coolDown,
+		}
+		bs.m[host] = b
+	}
+	return b
+}
+
+func (bs *breakers) states() map[string]BreakerState {
+	bs.mu.Lock()
+	hosts := make([]*circuitBreaker, 0, len(bs.m))
+	for _, b := range bs.m {
+		hosts = append(hosts, b)
+	}
+	bs.mu.Unlock()
+
+	ret := make(map[string]BreakerState, len(hosts))
+	for _, b := range hosts {
+		ret[b.host] = b.getState()
+	}
+	return ret
+}
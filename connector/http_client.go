@@ -2,33 +2,123 @@ package connector
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
+	"strconv"
 	"time"
 
+	"github.com/NuttapolCha/test-band-data-feeder/clock"
 	"github.com/NuttapolCha/test-band-data-feeder/log"
+	"github.com/spf13/viper"
 
 	"net/http"
 )
 
+// StatusError is returned when the endpoint responds with non 2xx status code.
+type StatusError struct {
+	StatusCode int
+	Status     string
+
+	retryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("got unexpected response %s", e.Status)
+}
+
+// RequestError is returned when a request is given up, it tells the last status code
+// (zero if no response was received) and how many attempts were made.
+type RequestError struct {
+	Method     string
+	Endpoint   string
+	StatusCode int
+	Attempts   int
+	Err        error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("could not %s Request to %s after %d attempts because: %v", e.Method, e.Endpoint, e.Attempts, e.Err)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
 type CustomHttpClient struct {
-	logger log.Logger
+	logger   log.Logger
+	client   *http.Client
+	breakers *breakers
+
+	// backoff and circuit breakers wait on it, latencies are measured in wall time
+	clock clock.Clock
 }
 
-func NewCustomHttpClient(logger log.Logger) *CustomHttpClient {
+// NewCustomHttpClient returns a client configured by ExternalAPIs of v.
+func NewCustomHttpClient(logger log.Logger, v *viper.Viper, clk clock.Clock) *CustomHttpClient {
+	config := getClientConfig(v)
 	return &CustomHttpClient{
 		logger: logger,
+		client: &http.Client{
+			Timeout: config.timeout,
+		},
+		breakers: newBreakers(logger, clk, config.failureThreshold, config.coolDown),
+		clock:    clk,
 	}
 }
 
-func (c *CustomHttpClient) Get(endpoint string, queryStr map[string]string, retryCount int) ([]byte, error) {
-	logger := c.logger
+type clientConfig struct {
+	// timeout of each attempt, the caller context bounds all attempts
+	timeout time.Duration
 
-	start := time.Now()
-	var err error
+	// consecutive failures to open the circuit of a host, negative disables circuit breaker
+	failureThreshold int
+	coolDown         time.Duration
+}
+
+func getClientConfig(v *viper.Viper) clientConfig {
+	config := clientConfig{
+		timeout:          getSeconds(v, "ExternalAPIs.Timeout"),
+		failureThreshold: v.GetInt("ExternalAPIs.CircuitBreaker.FailureThreshold"),
+		coolDown:         getSeconds(v, "ExternalAPIs.CircuitBreaker.CoolDown"),
+	}
+	if config.timeout == 0 {
+		config.timeout = 10 * time.Second
+	}
+	if config.failureThreshold == 0 {
+		config.failureThreshold = 5
+	}
+	if config.coolDown == 0 {
+		config.coolDown = 30 * time.Second
+	}
+	return config
+}
+
+// Describe returns the client config in effect read from v keyed by config key, defaults included.
+func Describe(v *viper.Viper) map[string]string {
+	config := getClientConfig(v)
+	return map[string]string{
+		"ExternalAPIs.Timeout":                         config.timeout.String(),
+		"ExternalAPIs.CircuitBreaker.FailureThreshold": strconv.Itoa(config.failureThreshold),
+		"ExternalAPIs.CircuitBreaker.CoolDown":         config.coolDown.String(),
+	}
+}
+
+// getSeconds reads key as a number of seconds, fractions of a second are kept.
+func getSeconds(v *viper.Viper, key string) time.Duration {
+	return time.Duration(v.GetFloat64(key) * float64(time.Second))
+}
+
+// BreakerStates returns circuit breaker state of every host requested so far.
+func (c *CustomHttpClient) BreakerStates() map[string]BreakerState {
+	return c.breakers.states()
+}
+
+func (c *CustomHttpClient) Get(ctx context.Context, endpoint string, queryStr map[string]string, policy *RetryPolicy) ([]byte, error) {
+	logger := log.FromContext(ctx, c.logger).With(log.Endpoint(endpoint))
 
 	// establish a new request
-	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
 		logger.Errorf("could not establish a new request to %s because: %v", endpoint, err)
 		return nil, err
@@ -40,85 +130,157 @@ func (c *CustomHttpClient) Get(endpoint string, queryStr map[string]string, retr
 		q.Add(key, val)
 	}
 	req.URL.RawQuery = q.Encode()
+	logger.Debugf("query: %s", req.URL.RawQuery)
 
-	// requests up to defined attempts
-	client := http.DefaultClient
-	for attmps := 0; attmps < retryCount+1; attmps++ {
-		var resp *http.Response
-		var respBody []byte
+	return c.do(ctx, policy, func() (*http.Request, error) {
+		return req, nil
+	})
+}
 
-		logger.Debugf("attemp: %d requesting to %s", attmps+1, endpoint)
-		logger.Debugf("query: %s", req.URL.RawQuery)
-		resp, err = client.Do(req)
-		if err != nil {
-			logger.Errorf("attempt: %d could not GET Request to %s because: %v, will retry in 1 seconds", attmps+1, endpoint, err)
-			time.Sleep(1 * time.Second)
-			continue
-		}
-		defer resp.Body.Close()
+func (c *CustomHttpClient) PostJSON(ctx context.Context, endpoint string, body []byte, policy *RetryPolicy) ([]byte, error) {
+	logger := log.FromContext(ctx, c.logger).With(log.Endpoint(endpoint))
+
+	logger.Debugf("request body = ")
+	logger.BeautyJSON(body)
 
-		respBody, err = c.resolveRespResult(resp)
+	return c.do(ctx, policy, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(body))
 		if err != nil {
-			logger.Errorf("attempt: %d could not resolve response result from %s because: %v, will retry in 1 seconds", attmps+1, endpoint, err)
-			time.Sleep(1 * time.Second)
-			continue
+			return nil, err
 		}
-
-		logger.Debugf("request to %s success, time used: %v", endpoint, time.Since(start))
-		return respBody, nil
-	}
-
-	// attemps have been reached the maximum
-	logger.Errorf("could not GET Request to %s after %d attempts because: %v", endpoint, retryCount, err)
-	return nil, err
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
 }
 
-func (c *CustomHttpClient) PostJSON(endpoint string, body []byte, retryCount int) ([]byte, error) {
-	logger := c.logger
+// do sends the request made by newReq up to the policy maximum attempts.
+// Transport errors and retryable status codes are retried with backoff,
+// any other status code fails fast.
+func (c *CustomHttpClient) do(ctx context.Context, policy *RetryPolicy, newReq func() (*http.Request, error)) ([]byte, error) {
+	logger := log.FromContext(ctx, c.logger)
 
 	start := time.Now()
-	var err error
+	maxAttempts := policy.maxAttempts()
 
-	// requests up to defined attempts
-	for attmps := 0; attmps < retryCount+1; attmps++ {
-		var resp *http.Response
-		var respBody []byte
+	var lastErr error
+	var lastStatusErr *StatusError
+	var method, endpoint, host string
+	attempts := 0
 
-		logger.Debugf("attempt: %d requesting to %s", attmps+1, endpoint)
-		logger.Debugf("request body = ")
-		logger.BeautyJSON(body)
-		resp, err = http.Post(endpoint, "application/json", bytes.NewBuffer(body))
+	requestError := func(err error) *RequestError {
+		reqErr := &RequestError{
+			Method:   method,
+			Endpoint: endpoint,
+			Attempts: attempts,
+			Err:      err,
+		}
+		if lastStatusErr != nil {
+			reqErr.StatusCode = lastStatusErr.StatusCode
+		}
+		return reqErr
+	}
+	giveUp := func(err error) error {
+		reqErr := requestError(err)
+		logger.Errorf("%v", reqErr)
+		return reqErr
+	}
+
+	for attempts < maxAttempts {
+		if attempts > 0 {
+			var retryAfter time.Duration
+			if lastStatusErr != nil {
+				retryAfter = lastStatusErr.retryAfter
+			}
+			delay := policy.backoff(attempts, retryAfter)
+			logger.Debugf("attempt: %d will retry requesting to %s in %v", attempts, endpoint, delay)
+			retriesTotal.Inc(host, method)
+			if err := clock.Sleep(ctx, c.clock, delay); err != nil {
+				return nil, giveUp(err)
+			}
+		}
+
+		req, err := newReq()
 		if err != nil {
-			logger.Errorf("attempt: %d could not POST Request to %s because: %v will retry in 1 seconds", attmps+1, endpoint, err)
-			time.Sleep(1 * time.Second)
+			logger.Errorf("could not establish a new request because: %v", err)
+			return nil, err
+		}
+		method, endpoint, host = req.Method, req.URL.Scheme+"://"+req.URL.Host+req.URL.Path, req.URL.Host
+		logger = log.FromContext(ctx, c.logger).With(log.Endpoint(endpoint))
+
+		breaker := c.breakers.get(req.URL.Host)
+		if err := breaker.allow(); err != nil {
+			// the breaker has logged its transition, no need to flood logs here
+			logger.Debugf("skip requesting to %s because: %v", endpoint, err)
+			return nil, requestError(err)
+		}
+		attempts++
+
+		logger.With(log.Attempt(attempts)).Debugf("attempt: %d requesting to %s", attempts, endpoint)
+		attemptStart := time.Now()
+		resp, err := c.client.Do(req)
+		latency := time.Since(attemptStart)
+		requestDuration.Observe(latency.Seconds(), host, method)
+		attemptLogger := logger.With(log.Attempt(attempts), log.Latency(latency))
+		if err != nil {
+			requestsTotal.Inc(host, method, "error")
+			lastErr, lastStatusErr = err, nil
+			if ctx.Err() != nil {
+				// cancelled by caller, the host is not to blame
+				breaker.onCancel()
+				return nil, giveUp(ctx.Err())
+			}
+			breaker.onFailure()
+			attemptLogger.Errorf("attempt: %d could not %s Request to %s because: %v", attempts, method, endpoint, err)
 			continue
 		}
-		defer resp.Body.Close()
 
-		respBody, err = c.resolveRespResult(resp)
+		requestsTotal.Inc(host, method, strconv.Itoa(resp.StatusCode))
+		respBody, err := c.resolveRespResult(resp)
 		if err != nil {
-			logger.Errorf("attempt: %d could not resolve response result from %s because: %v, will retry in 1 seconds", attmps+1, endpoint, err)
-			time.Sleep(1 * time.Second)
+			lastErr, lastStatusErr = err, nil
+			statusErr, ok := err.(*StatusError)
+			if ok {
+				lastStatusErr = statusErr
+				if policy.isExpectedStatus(statusErr.StatusCode) {
+					// the caller takes it as a result, nothing has gone wrong
+					breaker.onSuccess()
+					attemptLogger.Debugf("attempt: %d status %d from %s is expected", attempts, statusErr.StatusCode, endpoint)
+					return nil, requestError(err)
+				}
+				if !policy.isRetryableStatus(statusErr.StatusCode) {
+					// the host is up, it just does not like the request
+					breaker.onSuccess()
+					attemptLogger.Debugf("attempt: %d status %d from %s is not retryable", attempts, statusErr.StatusCode, endpoint)
+					return nil, giveUp(err)
+				}
+			}
+			breaker.onFailure()
+			attemptLogger.Errorf("attempt: %d could not resolve response result from %s because: %v", attempts, endpoint, err)
 			continue
 		}
 
-		logger.Debugf("request to %s success, time used: %v", endpoint, time.Since(start))
+		breaker.onSuccess()
+		attemptLogger.Debugf("request to %s success, time used: %v", endpoint, time.Since(start))
 		return respBody, nil
 	}
 
 	// attemps have been reached the maximum
-	logger.Errorf("could not POST Request to %s after %d attempts because: %v", endpoint, retryCount, err)
-	return nil, err
+	return nil, giveUp(lastErr)
 }
 
 func (c *CustomHttpClient) resolveRespResult(resp *http.Response) ([]byte, error) {
-	logger := c.logger
+	logger := log.FromContext(resp.Request.Context(), c.logger)
+	defer resp.Body.Close()
 
 	var err error
 
 	// check resposne status
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("got unexpected response %s", resp.Status)
+		return nil, &StatusError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			retryAfter: parseRetryAfter(resp, c.clock.Now()),
+		}
 	}
 
 	// read response body
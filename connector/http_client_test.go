@@ -0,0 +1,73 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/NuttapolCha/test-band-data-feeder/clock"
+	"github.com/NuttapolCha/test-band-data-feeder/log"
+	"github.com/spf13/viper"
+)
+
+// newTestClient returns a client on clk logging to a file of the test, the file path is returned as well.
+func newTestClient(t *testing.T, clk clock.Clock, config map[string]interface{}) (*CustomHttpClient, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "client.log")
+	v := viper.New()
+	v.Set("Log.Output", path)
+	for key, val := range config {
+		v.Set(key, val)
+	}
+	logger, err := log.NewLogger(v)
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	t.Cleanup(func() { logger.Close() })
+	return NewCustomHttpClient(logger, v, clk), path
+}
+
+func TestExpectedStatus(t *testing.T) {
+	t.Parallel()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	client, logPath := newTestClient(t, clock.New(), map[string]interface{}{
+		"ExternalAPIs.CircuitBreaker.FailureThreshold": 2,
+	})
+	policy := NewRetryPolicy(2, 0, 0, 0, nil).Expecting(http.StatusNotFound)
+	for i := 0; i < 3; i++ {
+		_, err := client.Get(context.Background(), server.URL+"/request/1", nil, policy)
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+			t.Fatalf("error is %v, want status 404", err)
+		}
+	}
+
+	// expected status is neither retried nor blamed on the host
+	if requests != 3 {
+		t.Errorf("%d requests for 3 gets, want 3", requests)
+	}
+	for host, state := range client.BreakerStates() {
+		if state != BreakerClosed {
+			t.Errorf("circuit of %s is %v, want closed", host, state)
+		}
+	}
+	// the log file is created on the first entry
+	logs, err := os.ReadFile(logPath)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("could not read logs: %v", err)
+	}
+	if strings.Contains(string(logs), "ERROR") {
+		t.Errorf("expected status is logged as an error:\n%s", logs)
+	}
+}
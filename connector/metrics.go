@@ -0,0 +1,27 @@
+package connector
+
+import "github.com/NuttapolCha/test-band-data-feeder/metrics"
+
+var (
+	requestsTotal = metrics.NewCounterVec(
+		"http_client_requests_total",
+		"Number of HTTP request attempts by host, method and response status code (or error).",
+		"host", "method", "code",
+	)
+	requestDuration = metrics.NewHistogramVec(
+		"http_client_request_duration_seconds",
+		"Latency of each HTTP request attempt.",
+		nil,
+		"host", "method",
+	)
+	retriesTotal = metrics.NewCounterVec(
+		"http_client_retries_total",
+		"Number of retried HTTP request attempts.",
+		"host", "method",
+	)
+	breakerState = metrics.NewGaugeVec(
+		"http_client_circuit_breaker_state",
+		"Circuit breaker state of each host, 0 is closed, 1 is open and 2 is half-open.",
+		"host",
+	)
+)
@@ -0,0 +1,151 @@
+package connector
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy tells the client how many times and how long to wait before retrying a request.
+type RetryPolicy struct {
+	// MaxAttempts includes the first attempt, it is always at least 1
+	MaxAttempts int
+
+	// delay before the n-th retry is BaseDelay * 2^(n-1) capped at MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// Jitter is a fraction [0, 1] of the delay to be randomly subtracted,
+	// so many clients do not retry at the same moment
+	Jitter float64
+
+	// RetryableStatusCodes are response status codes worth retrying,
+	// any other non 2xx status code fails fast
+	RetryableStatusCodes []int
+
+	// ExpectedStatusCodes are non 2xx status codes the caller takes as a result, e.g. 404 of
+	// something not ready yet, they fail fast without being logged as errors or blamed on the host
+	ExpectedStatusCodes []int
+}
+
+// DefaultRetryableStatusCodes are timeout, too many requests and temporary server errors.
+var DefaultRetryableStatusCodes = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// NewRetryPolicy returns a policy retrying up to retryCount times with exponential backoff,
+// zero values are replaced by defaults.
+func NewRetryPolicy(retryCount int, baseDelay, maxDelay time.Duration, jitter float64, retryableStatusCodes []int) *RetryPolicy {
+	if retryCount < 0 {
+		retryCount = 0
+	}
+	if baseDelay <= 0 {
+		baseDelay = 500 * time.Millisecond
+	}
+	if maxDelay < baseDelay {
+		maxDelay = baseDelay
+	}
+	if jitter < 0 {
+		jitter = 0
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+	if len(retryableStatusCodes) == 0 {
+		retryableStatusCodes = DefaultRetryableStatusCodes
+	}
+
+	return &RetryPolicy{
+		MaxAttempts:          retryCount + 1,
+		BaseDelay:            baseDelay,
+		MaxDelay:             maxDelay,
+		Jitter:               jitter,
+		RetryableStatusCodes: retryableStatusCodes,
+	}
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p == nil || p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+func (p *RetryPolicy) isRetryableStatus(statusCode int) bool {
+	for _, code := range p.RetryableStatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// Expecting returns a copy of the policy taking statusCodes as results rather than failures.
+func (p *RetryPolicy) Expecting(statusCodes ...int) *RetryPolicy {
+	expecting := &RetryPolicy{}
+	if p != nil {
+		*expecting = *p
+	}
+	expecting.ExpectedStatusCodes = append(append([]int(nil), expecting.ExpectedStatusCodes...), statusCodes...)
+	return expecting
+}
+
+func (p *RetryPolicy) isExpectedStatus(statusCode int) bool {
+	if p == nil {
+		return false
+	}
+	for _, code := range p.ExpectedStatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay before the given retry (starting from 1).
+// Server's Retry-After is honored if it is longer than the computed delay, up to MaxDelay
+// so that a misbehaving server cannot stall the caller.
+func (p *RetryPolicy) backoff(retry int, retryAfter time.Duration) time.Duration {
+	delay := p.MaxDelay
+	if shift := retry - 1; shift < 32 {
+		if d := p.BaseDelay << uint(shift); d > 0 && d < p.MaxDelay {
+			delay = d
+		}
+	}
+	delay -= time.Duration(p.Jitter * rand.Float64() * float64(delay))
+
+	if retryAfter > p.MaxDelay {
+		retryAfter = p.MaxDelay
+	}
+	if retryAfter > delay {
+		return retryAfter
+	}
+	return delay
+}
+
+// parseRetryAfter parses Retry-After header in either delay-seconds or HTTP-date form,
+// a date is relative to now.
+func parseRetryAfter(resp *http.Response, now time.Time) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	val := resp.Header.Get("Retry-After")
+	if val == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(val); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(val); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
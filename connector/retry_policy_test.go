@@ -0,0 +1,196 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NuttapolCha/test-band-data-feeder/clock"
+)
+
+func TestRetryableStatus(t *testing.T) {
+	t.Parallel()
+	tests := map[int]bool{
+		http.StatusRequestTimeout:      true,
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusBadGateway:          true,
+		http.StatusServiceUnavailable:  true,
+		http.StatusGatewayTimeout:      true,
+		http.StatusBadRequest:          false,
+		http.StatusUnauthorized:        false,
+		http.StatusForbidden:           false,
+		http.StatusNotFound:            false,
+		http.StatusConflict:            false,
+		http.StatusUnprocessableEntity: false,
+	}
+	for status, retryable := range tests {
+		status, retryable := status, retryable
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			t.Parallel()
+			var mu sync.Mutex
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				requests++
+				mu.Unlock()
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			clk := clock.NewManual(time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC))
+			client, _ := newTestClient(t, clk, map[string]interface{}{
+				"ExternalAPIs.CircuitBreaker.FailureThreshold": -1,
+			})
+			policy := NewRetryPolicy(2, time.Second, 4*time.Second, 0, nil)
+
+			errs := make(chan error, 1)
+			go func() {
+				_, err := client.Get(context.Background(), server.URL, nil, policy)
+				errs <- err
+			}()
+			if retryable {
+				// retried after 1s and then 2s of backoff
+				for _, d := range []time.Duration{time.Second, 2 * time.Second} {
+					clk.BlockUntilSleepers(1)
+					clk.Advance(d)
+				}
+			}
+
+			var err error
+			select {
+			case err = <-errs:
+			case <-time.After(10 * time.Second):
+				t.Fatalf("request did not complete within 10s")
+			}
+			var reqErr *RequestError
+			if !errors.As(err, &reqErr) || reqErr.StatusCode != status {
+				t.Fatalf("error is %v, want status %d", err, status)
+			}
+			want := 1
+			if retryable {
+				want = policy.MaxAttempts
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if requests != want || reqErr.Attempts != want {
+				t.Errorf("%d requests in %d attempts, want %d", requests, reqErr.Attempts, want)
+			}
+		})
+	}
+}
+
+func TestRetryAfterCappedAtMaxDelay(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	clk := clock.NewManual(time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC))
+	client, _ := newTestClient(t, clk, nil)
+	policy := NewRetryPolicy(1, time.Second, 4*time.Second, 0, nil)
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := client.Get(context.Background(), server.URL, nil, policy)
+		errs <- err
+	}()
+
+	// the retry is made once MaxDelay has passed rather than an hour later
+	clk.BlockUntilSleepers(1)
+	clk.Advance(policy.MaxDelay)
+	select {
+	case err := <-errs:
+		var reqErr *RequestError
+		if !errors.As(err, &reqErr) || reqErr.Attempts != 2 {
+			t.Errorf("error is %v, want 2 attempts", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("request is not retried after MaxDelay")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+	policy := NewRetryPolicy(10, time.Second, 10*time.Second, 0, nil)
+
+	// doubled from the base delay and capped at the maximum delay
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, d := range want {
+		if got := policy.backoff(i+1, 0); got != d {
+			t.Errorf("retry %d: backoff is %v, want %v", i+1, got, d)
+		}
+	}
+	if got := policy.backoff(100, 0); got != policy.MaxDelay {
+		t.Errorf("retry 100: backoff is %v, want %v", got, policy.MaxDelay)
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	t.Parallel()
+	policy := NewRetryPolicy(10, time.Second, 10*time.Second, 0.5, nil)
+
+	// a random fraction up to Jitter of the delay is subtracted
+	for i := 0; i < 1000; i++ {
+		got := policy.backoff(3, 0)
+		if got < 2*time.Second || got > 4*time.Second {
+			t.Fatalf("backoff of jitter 0.5 is %v, want between 2s and 4s", got)
+		}
+	}
+}
+
+func TestBackoffRetryAfter(t *testing.T) {
+	t.Parallel()
+	policy := NewRetryPolicy(10, time.Second, 10*time.Second, 0, nil)
+
+	tests := []struct {
+		retryAfter time.Duration
+		want       time.Duration
+	}{
+		// shorter than the computed delay is ignored
+		{500 * time.Millisecond, time.Second},
+		{3 * time.Second, 3 * time.Second},
+		// a misbehaving server cannot stall the caller
+		{time.Hour, 10 * time.Second},
+	}
+	for _, test := range tests {
+		if got := policy.backoff(1, test.retryAfter); got != test.want {
+			t.Errorf("backoff with Retry-After %v is %v, want %v", test.retryAfter, got, test.want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	t.Parallel()
+	clk := clock.NewManual(time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC))
+	now := clk.Now()
+
+	tests := map[string]time.Duration{
+		"":     0,
+		"120":  2 * time.Minute,
+		"0":    0,
+		"-5":   0,
+		"soon": 0,
+		now.Add(90 * time.Second).Format(http.TimeFormat): 90 * time.Second,
+		now.Add(-time.Minute).Format(http.TimeFormat):     0,
+	}
+	for header, want := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		if header != "" {
+			resp.Header.Set("Retry-After", header)
+		}
+		if got := parseRetryAfter(resp, clk.Now()); got != want {
+			t.Errorf("Retry-After %q is parsed as %v, want %v", header, got, want)
+		}
+	}
+	if got := parseRetryAfter(nil, now); got != 0 {
+		t.Errorf("Retry-After without response is %v, want 0", got)
+	}
+}
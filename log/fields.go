@@ -0,0 +1,48 @@
+package log
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Field is a key value pair attached to log entries, see Logger.With
+type Field = zap.Field
+
+// fields shared across the feeder so that logs can be correlated
+
+func CycleID(id string) Field {
+	return zap.String("cycle_id", id)
+}
+
+func Symbol(symbol string) Field {
+	return zap.String("symbol", symbol)
+}
+
+func Endpoint(endpoint string) Field {
+	return zap.String("endpoint", endpoint)
+}
+
+func Attempt(attempt int) Field {
+	return zap.Int("attempt", attempt)
+}
+
+func Latency(latency time.Duration) Field {
+	return zap.Duration("latency", latency)
+}
+
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx carrying logger, see FromContext
+func NewContext(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, logger)
+}
+
+// FromContext returns logger carried by ctx, or fallback if there is none
+func FromContext(ctx context.Context, fallback Logger) Logger {
+	if logger, ok := ctx.Value(ctxKey{}).(Logger); ok {
+		return logger
+	}
+	return fallback
+}
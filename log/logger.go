@@ -2,10 +2,12 @@ package log
 
 import (
 	"encoding/json"
-	"log"
+	"fmt"
 	"strings"
 
 	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 type logLevel int
@@ -16,57 +18,191 @@ const (
 	verbose
 )
 
+func (lvl logLevel) String() string {
+	switch lvl {
+	case debug:
+		return "debug"
+	case verbose:
+		return "verbose"
+	}
+	return "info"
+}
+
+type logFormat string
+
+const (
+	consoleFormat logFormat = "console"
+	jsonFormat    logFormat = "json"
+)
+
 type Logger struct {
-	level logLevel
+	level   logLevel
+	format  logFormat
+	sugar   *zap.SugaredLogger
+	outputs []*output
 }
 
-// NewLogger initializes a simple logger
-func NewLogger() (Logger, error) {
-	var lvl logLevel
+// NewLogger initializes a logger writing to the outputs configured in v in console or JSON format
+func NewLogger(v *viper.Viper) (Logger, error) {
+	lvl := getLevel(v)
+	format, err := getFormat(v)
+	if err != nil {
+		return Logger{}, err
+	}
 
-	switch strings.ToLower(viper.GetString("Log.Level")) {
-	case "debug":
-		lvl = debug
-	case "verbose":
-		lvl = verbose
-	default:
-		lvl = info
+	zapLevel := zapcore.InfoLevel
+	if lvl >= debug {
+		zapLevel = zapcore.DebugLevel
+	}
+
+	names, err := parseOutputs(v.Get("Log.Output"))
+	if err != nil {
+		return Logger{}, fmt.Errorf("invalid Log.Output: %v", err)
+	}
+
+	// every output has its own core, so files never get colours of a terminal
+	r := getRotation(v)
+	outputs := make([]*output, 0, len(names))
+	cores := make([]zapcore.Core, 0, len(names))
+	for _, name := range names {
+		out := openOutput(name, r)
+		outputs = append(outputs, out)
+		cores = append(cores, zapcore.NewCore(newEncoder(format, out.colour), out.ws, zapLevel))
 	}
 
 	logger := Logger{
-		level: lvl,
+		level:   lvl,
+		format:  format,
+		sugar:   zap.New(zapcore.NewTee(cores...)).Sugar(),
+		outputs: outputs,
 	}
 
 	return logger, nil
 }
 
-func (logger *Logger) Infof(template string, args ...interface{}) {
-	log.Printf("\033[0;34m[INFO]\033[0;37m "+template+"\n", args...)
+// Describe returns the log config in effect read from v keyed by config key, defaults included.
+func Describe(v *viper.Viper) map[string]string {
+	d := map[string]string{
+		"Log.Level": getLevel(v).String(),
+	}
+	if format, err := getFormat(v); err == nil {
+		d["Log.Format"] = string(format)
+	}
+	if names, err := parseOutputs(v.Get("Log.Output")); err == nil {
+		d["Log.Output"] = strings.Join(names, ",")
+	}
+	r := getRotation(v)
+	d["Log.Rotation.MaxSize"] = fmt.Sprint(r.maxSize)
+	d["Log.Rotation.MaxAge"] = fmt.Sprint(r.maxAge)
+	d["Log.Rotation.MaxBackups"] = fmt.Sprint(r.maxBackups)
+	d["Log.Rotation.Compress"] = fmt.Sprint(r.compress)
+	return d
 }
 
-func (logger *Logger) Errorf(template string, args ...interface{}) {
-	log.Printf("\033[0;31m[ERROR]\033[0;37m "+template+"\n", args...)
+func getLevel(v *viper.Viper) logLevel {
+	switch strings.ToLower(v.GetString("Log.Level")) {
+	case "debug":
+		return debug
+	case "verbose":
+		return verbose
+	}
+	return info
 }
 
-func (logger *Logger) Warnf(template string, args ...interface{}) {
-	log.Printf("\033[0;33m[WARN]\033[0;37m "+template+"\n", args...)
+func getFormat(v *viper.Viper) (logFormat, error) {
+	format := logFormat(strings.ToLower(v.GetString("Log.Format")))
+	switch format {
+	case "":
+		return consoleFormat, nil
+	case consoleFormat, jsonFormat:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown log format %q, expected console or json", format)
 }
 
-func (logger *Logger) Debugf(template string, args ...interface{}) {
-	if logger.level < debug {
-		return
+func newEncoder(format logFormat, colour bool) zapcore.Encoder {
+	config := zapcore.EncoderConfig{
+		TimeKey:        "time",
+		LevelKey:       "level",
+		MessageKey:     "msg",
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeTime:     zapcore.ISO8601TimeEncoder,
+		EncodeDuration: zapcore.StringDurationEncoder,
 	}
-	log.Printf("\033[0;35m[DEBUG]\033[0;37m "+template+"\n", args...)
+
+	if format == jsonFormat {
+		config.EncodeLevel = zapcore.LowercaseLevelEncoder
+		config.EncodeDuration = zapcore.SecondsDurationEncoder
+		return zapcore.NewJSONEncoder(config)
+	}
+
+	// escape codes are garbage once the output is piped to a file
+	config.EncodeLevel = zapcore.CapitalLevelEncoder
+	if colour {
+		config.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	}
+	return zapcore.NewConsoleEncoder(config)
+}
+
+// With returns a child logger attaching fields to every entry it logs
+func (logger Logger) With(fields ...Field) Logger {
+	args := make([]interface{}, len(fields))
+	for i, field := range fields {
+		args[i] = field
+	}
+	logger.sugar = logger.sugar.With(args...)
+	return logger
+}
+
+// Sync flushes buffered log entries
+func (logger Logger) Sync() error {
+	return logger.sugar.Sync()
+}
+
+// Close closes log files, the logger and its children must not be used afterward
+func (logger Logger) Close() error {
+	var firstErr error
+	for _, out := range logger.outputs {
+		if out.closer == nil {
+			continue
+		}
+		if err := out.closer.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("could not close log output %s because: %v", out.name, err)
+		}
+	}
+	return firstErr
 }
 
-func (logger *Logger) BeautyJSON(bs []byte) {
+func (logger Logger) Infof(template string, args ...interface{}) {
+	logger.sugar.Infof(template, args...)
+}
+
+func (logger Logger) Errorf(template string, args ...interface{}) {
+	logger.sugar.Errorf(template, args...)
+}
+
+func (logger Logger) Warnf(template string, args ...interface{}) {
+	logger.sugar.Warnf(template, args...)
+}
+
+func (logger Logger) Debugf(template string, args ...interface{}) {
+	logger.sugar.Debugf(template, args...)
+}
+
+func (logger Logger) BeautyJSON(bs []byte) {
 	if logger.level < verbose {
 		return
 	}
 
+	// JSON output keeps the body as it is so that it can be queried
+	if logger.format == jsonFormat && json.Valid(bs) {
+		logger.sugar.Debugw("json body", "body", json.RawMessage(bs))
+		return
+	}
+
 	var i interface{}
 	json.Unmarshal(bs, &i)
 
 	res, _ := json.MarshalIndent(&i, "", "\t")
-	log.Printf("\033[0;35m[DEBUG]\033[0;37m " + string(res) + "\n")
+	logger.sugar.Debug(string(res))
 }
@@ -0,0 +1,158 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const megabyte = 1024 * 1024
+
+// output is a destination of log entries, either stdout, stderr or a rotated file
+type output struct {
+	name   string
+	ws     zapcore.WriteSyncer
+	colour bool
+
+	// nil for stdout and stderr, they are not ours to close
+	closer io.Closer
+}
+
+// rotation of file outputs, files are rotated once they reach maxSize megabytes or get maxAge days old,
+// rotated files older than maxAge days are removed as well
+type rotation struct {
+	maxSize    int
+	maxAge     int
+	maxBackups int
+	compress   bool
+}
+
+func getRotation(v *viper.Viper) rotation {
+	r := rotation{
+		maxSize:    v.GetInt("Log.Rotation.MaxSize"),
+		maxAge:     v.GetInt("Log.Rotation.MaxAge"),
+		maxBackups: v.GetInt("Log.Rotation.MaxBackups"),
+		compress:   v.GetBool("Log.Rotation.Compress"),
+	}
+	if r.maxSize == 0 {
+		r.maxSize = 100
+	}
+	return r
+}
+
+// parseOutputs accepts a comma separated string or a list of outputs, stderr if empty
+func parseOutputs(v interface{}) ([]string, error) {
+	var names []string
+
+	switch v := v.(type) {
+	case nil:
+	case string:
+		names = strings.Split(v, ",")
+	case []string, []interface{}:
+		s, err := cast.ToStringSliceE(v)
+		if err != nil {
+			return nil, err
+		}
+		names = s
+	default:
+		return nil, fmt.Errorf("expected a string or a list of outputs but got %T", v)
+	}
+
+	outputs := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("output %q is duplicated", name)
+		}
+		seen[name] = true
+		outputs = append(outputs, name)
+	}
+	if len(outputs) == 0 {
+		outputs = append(outputs, "stderr")
+	}
+	return outputs, nil
+}
+
+func openOutput(name string, r rotation) *output {
+	switch strings.ToLower(name) {
+	case "stdout":
+		return &output{name: name, ws: zapcore.Lock(os.Stdout), colour: isTerminal(os.Stdout)}
+	case "stderr":
+		return &output{name: name, ws: zapcore.Lock(os.Stderr), colour: isTerminal(os.Stderr)}
+	}
+
+	// lumberjack creates the file and its directory on the first write
+	f := &lumberjack.Logger{
+		Filename:   name,
+		MaxSize:    r.maxSize,
+		MaxAge:     r.maxAge,
+		MaxBackups: r.maxBackups,
+		Compress:   r.compress,
+		LocalTime:  true,
+	}
+	af := newAgedFile(f, time.Duration(r.maxAge)*24*time.Hour, time.Now)
+	return &output{name: name, ws: zapcore.AddSync(af), closer: f}
+}
+
+// agedFile rotates the file once it gets maxAge old, lumberjack only rotates by size
+// and uses the age to remove rotated files
+type agedFile struct {
+	file   *lumberjack.Logger
+	maxAge time.Duration
+	now    func() time.Time
+
+	mu sync.Mutex
+	// when the current file was started and its size, a file existing already is aged from opening it
+	born time.Time
+	size int64
+}
+
+func newAgedFile(f *lumberjack.Logger, maxAge time.Duration, now func() time.Time) *agedFile {
+	af := &agedFile{file: f, maxAge: maxAge, now: now, born: now()}
+	if fi, err := os.Stat(f.Filename); err == nil {
+		af.size = fi.Size()
+	}
+	return af
+}
+
+func (f *agedFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	switch {
+	case f.maxAge > 0 && now.Sub(f.born) >= f.maxAge:
+		if err := f.file.Rotate(); err != nil {
+			return 0, err
+		}
+		f.born, f.size = now, 0
+	case f.size+int64(len(p)) > int64(f.file.MaxSize)*megabyte:
+		// lumberjack rotates it on this write
+		f.born, f.size = now, 0
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// isTerminal reports whether f is a terminal rather than a pipe or a regular file
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
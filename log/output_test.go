@@ -0,0 +1,80 @@
+package log
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+func backups(t *testing.T, dir string) []string {
+	t.Helper()
+	names, err := filepath.Glob(filepath.Join(dir, "feeder-*.log"))
+	if err != nil {
+		t.Fatalf("could not list backups: %v", err)
+	}
+	return names
+}
+
+func TestOutputRotatedBySize(t *testing.T) {
+	dir := t.TempDir()
+	out := openOutput(filepath.Join(dir, "feeder.log"), rotation{maxSize: 1})
+	defer out.closer.Close()
+
+	line := append(bytes.Repeat([]byte("x"), 1023), '\n')
+	for i := 0; i < 1025; i++ {
+		if _, err := out.ws.Write(line); err != nil {
+			t.Fatalf("could not write: %v", err)
+		}
+	}
+
+	if n := len(backups(t, dir)); n != 1 {
+		t.Fatalf("%d backups after writing past MaxSize, want 1", n)
+	}
+	fi, err := os.Stat(filepath.Join(dir, "feeder.log"))
+	if err != nil {
+		t.Fatalf("could not stat log file: %v", err)
+	}
+	if fi.Size() != int64(len(line)) {
+		t.Errorf("log file has %d bytes after rotation, want %d", fi.Size(), len(line))
+	}
+}
+
+func TestOutputRotatedByAge(t *testing.T) {
+	dir := t.TempDir()
+	f := &lumberjack.Logger{Filename: filepath.Join(dir, "feeder.log"), MaxSize: 1, LocalTime: true}
+	defer f.Close()
+
+	now := time.Now()
+	af := newAgedFile(f, 24*time.Hour, func() time.Time { return now })
+
+	write := func() {
+		t.Helper()
+		if _, err := af.Write([]byte("entry\n")); err != nil {
+			t.Fatalf("could not write: %v", err)
+		}
+	}
+
+	write()
+	now = now.Add(23 * time.Hour)
+	write()
+	if n := len(backups(t, dir)); n != 0 {
+		t.Fatalf("%d backups before the file gets MaxAge old, want none", n)
+	}
+
+	now = now.Add(time.Hour)
+	write()
+	if n := len(backups(t, dir)); n != 1 {
+		t.Fatalf("%d backups once the file gets MaxAge old, want 1", n)
+	}
+
+	// the file is aged from the rotation
+	now = now.Add(23 * time.Hour)
+	write()
+	if n := len(backups(t, dir)); n != 1 {
+		t.Errorf("%d backups before the new file gets MaxAge old, want 1", n)
+	}
+}
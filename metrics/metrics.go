@@ -0,0 +1,240 @@
+// Package metrics implements counters, gauges and histograms exposed
+// in Prometheus text exposition format, without depending on Prometheus client.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are upper bounds in seconds suitable for request latency.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metricType string
+
+const (
+	counterType   metricType = "counter"
+	gaugeType     metricType = "gauge"
+	histogramType metricType = "histogram"
+)
+
+// collector is a metric family, i.e. a metric with every combination of its label values.
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry holds metric families to be exposed.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: make(map[string]collector),
+	}
+}
+
+// DefaultRegistry is where the New* functions register metrics to.
+var DefaultRegistry = NewRegistry()
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.collectors[c.name()]; ok {
+		panic(fmt.Sprintf("metric %s has already been registered", c.name()))
+	}
+	r.collectors[c.name()] = c
+}
+
+// Expose writes every metric in text exposition format sorted by name.
+func (r *Registry) Expose(w io.Writer) {
+	r.mu.Lock()
+	collectors := make([]collector, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		collectors = append(collectors, c)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler serves metrics of the registry, it is meant to be mounted at /metrics.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Expose(w)
+	})
+}
+
+// Handler serves metrics of DefaultRegistry.
+func Handler() http.Handler {
+	return DefaultRegistry.Handler()
+}
+
+// family keeps children of a metric family keyed by their label values.
+type family struct {
+	metricName string
+	help       string
+	typ        metricType
+	labelNames []string
+
+	mu       sync.Mutex
+	children map[string]*child
+}
+
+type child struct {
+	labelValues []string
+
+	mu sync.Mutex
+	// counter and gauge value, or histogram sum
+	value float64
+
+	// histogram only
+	buckets []float64
+	counts  []uint64
+	count   uint64
+}
+
+func newFamily(metricName, help string, typ metricType, labelNames []string) *family {
+	return &family{
+		metricName: metricName,
+		help:       help,
+		typ:        typ,
+		labelNames: labelNames,
+		children:   make(map[string]*child),
+	}
+}
+
+func (f *family) name() string {
+	return f.metricName
+}
+
+func (f *family) with(labelValues []string, buckets []float64) *child {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values but got %d", f.metricName, len(f.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, ok := f.children[key]
+	if !ok {
+		c = &child{
+			labelValues: append([]string(nil), labelValues...),
+			buckets:     buckets,
+		}
+		if buckets != nil {
+			c.counts = make([]uint64, len(buckets))
+		}
+		f.children[key] = c
+	}
+	return c
+}
+
+// initUnlabeled exposes metric without labels as zero before its first observation.
+func (f *family) initUnlabeled(buckets []float64) {
+	if len(f.labelNames) == 0 {
+		f.with(nil, buckets)
+	}
+}
+
+func (f *family) delete(labelValues []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.children, strings.Join(labelValues, "\xff"))
+}
+
+func (f *family) write(w io.Writer) {
+	f.mu.Lock()
+	children := make([]*child, 0, len(f.children))
+	for _, c := range f.children {
+		children = append(children, c)
+	}
+	f.mu.Unlock()
+
+	sort.Slice(children, func(i, j int) bool {
+		return strings.Join(children[i].labelValues, ",") < strings.Join(children[j].labelValues, ",")
+	})
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.metricName, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.metricName, f.typ)
+	for _, c := range children {
+		c.mu.Lock()
+		labels := formatLabels(f.labelNames, c.labelValues)
+		if f.typ != histogramType {
+			fmt.Fprintf(w, "%s%s %s\n", f.metricName, wrapLabels(labels), formatFloat(c.value))
+			c.mu.Unlock()
+			continue
+		}
+
+		var cumulative uint64
+		for i, upperBound := range c.buckets {
+			cumulative += c.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.metricName, wrapLabels(joinLabels(labels, `le="`+formatFloat(upperBound)+`"`)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.metricName, wrapLabels(joinLabels(labels, `le="+Inf"`)), c.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.metricName, wrapLabels(labels), formatFloat(c.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.metricName, wrapLabels(labels), c.count)
+		c.mu.Unlock()
+	}
+}
+
+func formatLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, names[i], escapeLabelValue(values[i]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func joinLabels(labels, extra string) string {
+	if labels == "" {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+func wrapLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var (
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
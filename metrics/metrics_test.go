@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func expose(r *Registry) string {
+	var buf bytes.Buffer
+	r.Expose(&buf)
+	return buf.String()
+}
+
+func TestCounter(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("requests_total", "Number of requests.", "host", "code")
+	r.NewCounterVec("cycles_total", "Number of cycles.")
+
+	requests.Inc("b.example", "200")
+	requests.Inc("a.example", "500")
+	requests.Add(2.5, "a.example", "200")
+	requests.Inc("a.example", "200")
+
+	// families are sorted by name, children by label values, unlabeled ones start at zero
+	want := `# HELP cycles_total Number of cycles.
+# TYPE cycles_total counter
+cycles_total 0
+# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total{host="a.example",code="200"} 3.5
+requests_total{host="a.example",code="500"} 1
+requests_total{host="b.example",code="200"} 1
+`
+	if got := expose(r); got != want {
+		t.Errorf("exposed:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCounterCannotDecrease(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("requests_total", "Number of requests.")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("counter is decreased, want a panic")
+		}
+	}()
+	c.Add(-1)
+}
+
+func TestGauge(t *testing.T) {
+	r := NewRegistry()
+	price := r.NewGaugeVec("last_price", "Last price.", "symbol")
+
+	price.Set(40000, "BTC")
+	price.Set(3000, "ETH")
+	price.Set(0.5, "ADA")
+	price.Set(41000.25, "BTC")
+	price.Delete("ETH")
+
+	want := `# HELP last_price Last price.
+# TYPE last_price gauge
+last_price{symbol="ADA"} 0.5
+last_price{symbol="BTC"} 41000.25
+`
+	if got := expose(r); got != want {
+		t.Errorf("exposed:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	r := NewRegistry()
+	// buckets are sorted
+	latency := r.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 0.5, 2}, "host")
+
+	for _, v := range []float64{0.1, 0.5, 0.75, 1.5, 3} {
+		latency.Observe(v, "a.example")
+	}
+
+	want := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{host="a.example",le="0.5"} 2
+latency_seconds_bucket{host="a.example",le="1"} 3
+latency_seconds_bucket{host="a.example",le="2"} 4
+latency_seconds_bucket{host="a.example",le="+Inf"} 5
+latency_seconds_sum{host="a.example"} 5.85
+latency_seconds_count{host="a.example"} 5
+`
+	if got := expose(r); got != want {
+		t.Errorf("exposed:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUnlabeledHistogram(t *testing.T) {
+	r := NewRegistry()
+	r.NewHistogramVec("cycle_seconds", "Cycle duration.", []float64{1})
+
+	want := `# HELP cycle_seconds Cycle duration.
+# TYPE cycle_seconds histogram
+cycle_seconds_bucket{le="1"} 0
+cycle_seconds_bucket{le="+Inf"} 0
+cycle_seconds_sum 0
+cycle_seconds_count 0
+`
+	if got := expose(r); got != want {
+		t.Errorf("exposed:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("errors_total", "Errors by \\ reason,\nsee logs.", "reason")
+	c.Inc("path \"C:\\tmp\"\nnot found")
+
+	want := `# HELP errors_total Errors by \\ reason,\nsee logs.
+# TYPE errors_total counter
+errors_total{reason="path \"C:\\tmp\"\nnot found"} 1
+`
+	if got := expose(r); got != want {
+		t.Errorf("exposed:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("requests_total", "Number of requests.")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("metric is registered twice, want a panic")
+		}
+	}()
+	r.NewGaugeVec("requests_total", "Number of requests.")
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("requests_total", "Number of requests.")
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("content type is %q", ct)
+	}
+	if got, want := rec.Body.String(), expose(r); got != want {
+		t.Errorf("served:\n%s\nwant:\n%s", got, want)
+	}
+}
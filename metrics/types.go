@@ -0,0 +1,107 @@
+package metrics
+
+import "sort"
+
+// CounterVec is a counter partitioned by label values.
+type CounterVec struct {
+	f *family
+}
+
+// NewCounterVec registers a new counter to DefaultRegistry.
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return DefaultRegistry.NewCounterVec(name, help, labelNames...)
+}
+
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	f := newFamily(name, help, counterType, labelNames)
+	r.register(f)
+	f.initUnlabeled(nil)
+	return &CounterVec{f: f}
+}
+
+// Inc increases the counter of label values by 1.
+func (v *CounterVec) Inc(labelValues ...string) {
+	v.Add(1, labelValues...)
+}
+
+// Add increases the counter of label values by delta, delta must not be negative.
+func (v *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("counter cannot decrease")
+	}
+	c := v.f.with(labelValues, nil)
+	c.mu.Lock()
+	c.value += delta
+	c.mu.Unlock()
+}
+
+// GaugeVec is a gauge partitioned by label values.
+type GaugeVec struct {
+	f *family
+}
+
+// NewGaugeVec registers a new gauge to DefaultRegistry.
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return DefaultRegistry.NewGaugeVec(name, help, labelNames...)
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	f := newFamily(name, help, gaugeType, labelNames)
+	r.register(f)
+	f.initUnlabeled(nil)
+	return &GaugeVec{f: f}
+}
+
+// Set sets the gauge of label values.
+func (v *GaugeVec) Set(value float64, labelValues ...string) {
+	c := v.f.with(labelValues, nil)
+	c.mu.Lock()
+	c.value = value
+	c.mu.Unlock()
+}
+
+// Delete removes the gauge of label values, e.g. a symbol is no longer fed.
+func (v *GaugeVec) Delete(labelValues ...string) {
+	v.f.delete(labelValues)
+}
+
+// HistogramVec is a histogram partitioned by label values.
+type HistogramVec struct {
+	f       *family
+	buckets []float64
+}
+
+// NewHistogramVec registers a new histogram to DefaultRegistry,
+// nil buckets means DefaultBuckets.
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return DefaultRegistry.NewHistogramVec(name, help, buckets, labelNames...)
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	f := newFamily(name, help, histogramType, labelNames)
+	r.register(f)
+	f.initUnlabeled(buckets)
+	return &HistogramVec{f: f, buckets: buckets}
+}
+
+// Observe adds a single observation to the histogram of label values.
+func (v *HistogramVec) Observe(value float64, labelValues ...string) {
+	c := v.f.with(labelValues, v.buckets)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, upperBound := range c.buckets {
+		if value <= upperBound {
+			c.counts[i]++
+			break
+		}
+	}
+	c.count++
+	c.value += value
+}
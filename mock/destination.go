@@ -0,0 +1,156 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/NuttapolCha/test-band-data-feeder/log"
+)
+
+// DestinationPricing is the latest pricing of a symbol stored at destination.
+type DestinationPricing struct {
+	Price      json.Number `json:"price"`
+	LastUpdate int64       `json:"last_update"`
+}
+
+// Destination stands in for the destination service, posted prices are kept in memory as they are.
+//
+//	POST /update             {"symbols": [...], "prices": [...], "timestamp": 1} -> {}
+//	GET  /get_price?symbol=X -> {"price": 1.5, "last_update": 1}, zeros if X has never been updated
+type Destination struct {
+	logger log.Logger
+	faults *FaultInjector
+
+	mu      sync.Mutex
+	pricing map[string]*DestinationPricing
+	updates int
+}
+
+// NewDestination returns a destination injecting faults, faults can be nil.
+func NewDestination(logger log.Logger, faults *FaultInjector) *Destination {
+	return &Destination{
+		logger:  logger,
+		faults:  faults,
+		pricing: make(map[string]*DestinationPricing),
+	}
+}
+
+// Pricing returns a copy of the stored pricing keyed by symbol.
+func (d *Destination) Pricing() map[string]DestinationPricing {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ret := make(map[string]DestinationPricing, len(d.pricing))
+	for symbol, p := range d.pricing {
+		ret[symbol] = *p
+	}
+	return ret
+}
+
+// Updates returns how many updates have been accepted.
+func (d *Destination) Updates() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.updates
+}
+
+func (d *Destination) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case "/update":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		active := d.faults.activate(TargetDestination, EndpointUpdate)
+		fw, ok := active.intercept(w, r)
+		if !ok {
+			return
+		}
+		d.handleUpdate(fw, r, active)
+		fw.flush()
+	case "/get_price":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		active := d.faults.activate(TargetDestination, EndpointGetPrice)
+		fw, ok := active.intercept(w, r)
+		if !ok {
+			return
+		}
+		d.handleGetPrice(fw, r)
+		fw.flush()
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (d *Destination) handleUpdate(w http.ResponseWriter, r *http.Request, active *activeFaults) {
+	params := struct {
+		Symbols   []string      `json:"symbols"`
+		Prices    []json.Number `json:"prices"`
+		Timestamp int64         `json:"timestamp"`
+	}{}
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&params); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(params.Symbols) == 0 || len(params.Symbols) != len(params.Prices) {
+		http.Error(w, "symbols and prices must be non-empty and of the same length", http.StatusBadRequest)
+		return
+	}
+	for i, price := range params.Prices {
+		if _, err := price.Float64(); err != nil || params.Symbols[i] == "" {
+			http.Error(w, fmt.Sprintf("invalid pricing of symbol %q", params.Symbols[i]), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if active.ignoreUpdate() {
+		d.logger.Warnf("DESTINATION: ignored update of %v to %v at timestamp %d", params.Symbols, params.Prices, params.Timestamp)
+		writeJSON(w, http.StatusOK, struct{}{})
+		return
+	}
+	if factor := active.priceFactor(); factor != 1 {
+		for i, price := range params.Prices {
+			f, _ := price.Float64()
+			params.Prices[i] = json.Number(strconv.FormatFloat(f*factor, 'f', -1, 64))
+		}
+	}
+
+	d.mu.Lock()
+	for i, symbol := range params.Symbols {
+		d.pricing[symbol] = &DestinationPricing{
+			Price:      params.Prices[i],
+			LastUpdate: params.Timestamp,
+		}
+	}
+	d.updates++
+	d.mu.Unlock()
+
+	d.logger.Infof("DESTINATION: updated %v to %v at timestamp %d", params.Symbols, params.Prices, params.Timestamp)
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func (d *Destination) handleGetPrice(w http.ResponseWriter, r *http.Request) {
+	symbol := r.URL.Query().Get("symbol")
+	if symbol == "" {
+		http.Error(w, "symbol is required", http.StatusBadRequest)
+		return
+	}
+
+	d.mu.Lock()
+	pricing := DestinationPricing{Price: "0"}
+	if p, ok := d.pricing[symbol]; ok {
+		pricing = *p
+	}
+	d.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, &pricing)
+}
@@ -0,0 +1,329 @@
+package mock
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NuttapolCha/test-band-data-feeder/log"
+	"github.com/spf13/viper"
+)
+
+// targets and their endpoints faults can be injected into
+const (
+	TargetSource      = "source"
+	TargetDestination = "destination"
+
+	EndpointRequest    = "request"     // POST /request
+	EndpointGetRequest = "get_request" // GET /request/{id}
+	EndpointUpdate     = "update"      // POST /update
+	EndpointGetPrice   = "get_price"   // GET /get_price
+)
+
+// corruptions of response body
+const (
+	BodyTruncated = "truncated"
+	BodyGarbled   = "garbled"
+)
+
+// Fault is injected into requests to Endpoint of Target, any endpoint if empty,
+// from the From-th to the To-th request (1-based, inclusive, zero To means forever)
+// with probability Rate, always if Rate is not set and never if it is zero.
+type Fault struct {
+	Target   string
+	Endpoint string
+	From     int
+	To       int
+	Rate     *float64
+
+	// delays the response by a uniformly random duration in [LatencyMin, LatencyMax]
+	LatencyMin time.Duration
+	LatencyMax time.Duration
+
+	// responds with this status code instead
+	Status int
+
+	// corrupts the response body, either truncated or garbled
+	Body string
+
+	// source only, the symbols are left out of resolved price_results
+	DropSymbols []string
+
+	// destination only, responds as if the update was stored but it is not
+	IgnoreUpdate bool
+
+	// destination only, stores posted prices multiplied by this factor
+	PriceFactor float64
+}
+
+// Scenario is a set of faults, faults of the n-th request to an endpoint depend on the seed and n only,
+// so the same seed reproduces the same faults however concurrent requests interleave.
+type Scenario struct {
+	Seed   int64
+	Faults []*Fault
+}
+
+// LoadScenario reads scenario from a YAML or JSON file, keys are case insensitive.
+func LoadScenario(path string) (*Scenario, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("could not read scenario because: %w", err)
+	}
+	scenario := &Scenario{}
+	if err := v.Unmarshal(scenario); err != nil {
+		return nil, fmt.Errorf("could not parse scenario because: %w", err)
+	}
+	if err := scenario.validate(); err != nil {
+		return nil, err
+	}
+	return scenario, nil
+}
+
+func (s *Scenario) validate() error {
+	endpoints := map[string][]string{
+		TargetSource:      {"", EndpointRequest, EndpointGetRequest},
+		TargetDestination: {"", EndpointUpdate, EndpointGetPrice},
+	}
+
+	for i, f := range s.Faults {
+		valid, ok := endpoints[f.Target]
+		if !ok {
+			return fmt.Errorf("faults[%d]: target must be either %s or %s but got %q", i, TargetSource, TargetDestination, f.Target)
+		}
+		if !contains(valid, f.Endpoint) {
+			return fmt.Errorf("faults[%d]: unknown endpoint %q of %s", i, f.Endpoint, f.Target)
+		}
+		if f.From < 0 || f.To < 0 || (f.To > 0 && f.To < f.From) {
+			return fmt.Errorf("faults[%d]: invalid request window from %d to %d", i, f.From, f.To)
+		}
+		if f.Rate != nil && (*f.Rate < 0 || *f.Rate > 1) {
+			return fmt.Errorf("faults[%d]: rate must be between 0 and 1 but got %v", i, *f.Rate)
+		}
+		if f.LatencyMin < 0 || f.LatencyMax < 0 {
+			return fmt.Errorf("faults[%d]: latency must not be negative", i)
+		}
+		if f.Status != 0 && (f.Status < 400 || f.Status > 599) {
+			return fmt.Errorf("faults[%d]: status must be an error status but got %d", i, f.Status)
+		}
+		if f.Body != "" && f.Body != BodyTruncated && f.Body != BodyGarbled {
+			return fmt.Errorf("faults[%d]: body must be either %s or %s but got %q", i, BodyTruncated, BodyGarbled, f.Body)
+		}
+		if len(f.DropSymbols) > 0 && f.Target != TargetSource {
+			return fmt.Errorf("faults[%d]: symbols can be dropped by %s only", i, TargetSource)
+		}
+		if (f.IgnoreUpdate || f.PriceFactor != 0) && f.Target != TargetDestination {
+			return fmt.Errorf("faults[%d]: updates can be ignored or altered by %s only", i, TargetDestination)
+		}
+		if f.PriceFactor < 0 {
+			return fmt.Errorf("faults[%d]: price factor must be positive but got %v", i, f.PriceFactor)
+		}
+	}
+	return nil
+}
+
+// FaultInjector decides which faults apply to each request, nil injects nothing.
+type FaultInjector struct {
+	logger log.Logger
+	seed   int64
+	faults []*Fault
+
+	// requests so far keyed by target and endpoint
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func NewFaultInjector(logger log.Logger, scenario *Scenario) *FaultInjector {
+	seed := scenario.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &FaultInjector{
+		logger: logger,
+		seed:   seed,
+		faults: scenario.Faults,
+		counts: make(map[string]int),
+	}
+}
+
+// activeFaults are the faults applied to the n-th request to an endpoint.
+type activeFaults struct {
+	n      int
+	faults []*Fault
+}
+
+// activate counts the request to endpoint of target and returns faults applying to it.
+func (in *FaultInjector) activate(target, endpoint string) *activeFaults {
+	active := &activeFaults{}
+	if in == nil {
+		return active
+	}
+
+	in.mu.Lock()
+	key := target + " " + endpoint
+	in.counts[key]++
+	n := in.counts[key]
+	in.mu.Unlock()
+	active.n = n
+
+	for i, f := range in.faults {
+		if f.Target != target || (f.Endpoint != "" && f.Endpoint != endpoint) {
+			continue
+		}
+		if n < f.From || (f.To > 0 && n > f.To) {
+			continue
+		}
+		rng := in.rand(key, n, i)
+		if f.Rate != nil && rng.Float64() >= *f.Rate {
+			continue
+		}
+
+		f := *f
+		if f.LatencyMax > f.LatencyMin {
+			f.LatencyMin += time.Duration(rng.Int63n(int64(f.LatencyMax - f.LatencyMin)))
+		}
+		active.faults = append(active.faults, &f)
+		in.logger.Warnf("FAULT: %s %s request %d: %s", target, endpoint, n, f.describe())
+	}
+	return active
+}
+
+// rand returns the random source of the i-th fault at the n-th request to key, it is seeded
+// by them rather than shared, so draws do not depend on the order concurrent requests are drawn in.
+func (in *FaultInjector) rand(key string, n, i int) *rand.Rand {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d %s %d %d", in.seed, key, n, i)
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
+
+func (f *Fault) describe() string {
+	var parts []string
+	if f.LatencyMin > 0 {
+		parts = append(parts, fmt.Sprintf("latency %v", f.LatencyMin))
+	}
+	if f.Status != 0 {
+		parts = append(parts, fmt.Sprintf("status %d", f.Status))
+	}
+	if f.Body != "" {
+		parts = append(parts, f.Body+" body")
+	}
+	if len(f.DropSymbols) > 0 {
+		parts = append(parts, fmt.Sprintf("drop symbols %v", f.DropSymbols))
+	}
+	if f.IgnoreUpdate {
+		parts = append(parts, "ignore update")
+	}
+	if f.PriceFactor != 0 {
+		parts = append(parts, fmt.Sprintf("store prices * %v", f.PriceFactor))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// intercept delays the request and responds with the fault status if any,
+// it returns false if the request has been responded.
+// Otherwise the returned writer must be flushed after the handler has written the response.
+func (a *activeFaults) intercept(w http.ResponseWriter, r *http.Request) (*faultyWriter, bool) {
+	var latency time.Duration
+	status := 0
+	body := ""
+	for _, f := range a.faults {
+		latency += f.LatencyMin
+		if f.Status != 0 {
+			status = f.Status
+		}
+		if f.Body != "" {
+			body = f.Body
+		}
+	}
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-r.Context().Done():
+			return nil, false
+		case <-timer.C:
+		}
+	}
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return nil, false
+	}
+	return &faultyWriter{w: w, body: body, status: http.StatusOK}, true
+}
+
+func (a *activeFaults) dropped(symbol string) bool {
+	for _, f := range a.faults {
+		if contains(f.DropSymbols, symbol) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *activeFaults) ignoreUpdate() bool {
+	for _, f := range a.faults {
+		if f.IgnoreUpdate {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *activeFaults) priceFactor() float64 {
+	factor := 1.0
+	for _, f := range a.faults {
+		if f.PriceFactor != 0 {
+			factor *= f.PriceFactor
+		}
+	}
+	return factor
+}
+
+// faultyWriter buffers the response so that its body can be corrupted.
+type faultyWriter struct {
+	w      http.ResponseWriter
+	body   string
+	status int
+	buf    bytes.Buffer
+}
+
+func (fw *faultyWriter) Header() http.Header {
+	return fw.w.Header()
+}
+
+func (fw *faultyWriter) WriteHeader(status int) {
+	fw.status = status
+}
+
+func (fw *faultyWriter) Write(b []byte) (int, error) {
+	return fw.buf.Write(b)
+}
+
+func (fw *faultyWriter) flush() {
+	body := fw.buf.Bytes()
+	switch fw.body {
+	case BodyTruncated:
+		body = body[:len(body)/2]
+	case BodyGarbled:
+		body = []byte(strings.NewReplacer("{", "[", "\"", "'").Replace(string(body)))
+	}
+	fw.w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	fw.w.WriteHeader(fw.status)
+	fw.w.Write(body)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
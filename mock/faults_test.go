@@ -0,0 +1,195 @@
+package mock
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NuttapolCha/test-band-data-feeder/log"
+	"github.com/spf13/viper"
+)
+
+func newTestLogger(t *testing.T) log.Logger {
+	t.Helper()
+	logger, err := log.NewLogger(viper.New())
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	t.Cleanup(func() { logger.Close() })
+	return logger
+}
+
+func loadTestScenario(t *testing.T, content string) (*Scenario, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("could not write scenario: %v", err)
+	}
+	return LoadScenario(path)
+}
+
+func rate(r float64) *float64 {
+	return &r
+}
+
+func TestLoadScenario(t *testing.T) {
+	scenario, err := loadTestScenario(t, `
+Seed: 7
+Faults:
+  - Target: "source"
+    Endpoint: "request"
+    Status: 503
+  - Target: "destination"
+    Rate: 0
+    LatencyMin: "100ms"
+    LatencyMax: "1s"
+`)
+	if err != nil {
+		t.Fatalf("could not load scenario: %v", err)
+	}
+	if scenario.Seed != 7 || len(scenario.Faults) != 2 {
+		t.Fatalf("scenario is %+v", scenario)
+	}
+	if scenario.Faults[0].Rate != nil {
+		t.Errorf("unset rate is %v, want nil", *scenario.Faults[0].Rate)
+	}
+	if r := scenario.Faults[1].Rate; r == nil || *r != 0 {
+		t.Errorf("zero rate is %v, want 0", r)
+	}
+	if f := scenario.Faults[1]; f.LatencyMin != 100*time.Millisecond || f.LatencyMax != time.Second {
+		t.Errorf("latency is [%v, %v], want [100ms, 1s]", f.LatencyMin, f.LatencyMax)
+	}
+
+	invalid := map[string]string{
+		"unknown target":          `Faults: [{Target: "cache"}]`,
+		"unknown endpoint":        `Faults: [{Target: "source", Endpoint: "update"}]`,
+		"rate above one":          `Faults: [{Target: "source", Rate: 1.5}]`,
+		"negative rate":           `Faults: [{Target: "source", Rate: -0.1}]`,
+		"inverted window":         `Faults: [{Target: "source", From: 5, To: 3}]`,
+		"success status":          `Faults: [{Target: "source", Status: 200}]`,
+		"unknown body":            `Faults: [{Target: "source", Body: "empty"}]`,
+		"drop at destination":     `Faults: [{Target: "destination", DropSymbols: ["BTC"]}]`,
+		"ignore update at source": `Faults: [{Target: "source", IgnoreUpdate: true}]`,
+	}
+	for name, content := range invalid {
+		if _, err := loadTestScenario(t, content); err == nil {
+			t.Errorf("%s: scenario is loaded, want an error", name)
+		}
+	}
+}
+
+func TestFaultRate(t *testing.T) {
+	in := NewFaultInjector(newTestLogger(t), &Scenario{
+		Seed: 1,
+		Faults: []*Fault{
+			{Target: TargetSource, Endpoint: EndpointRequest, Status: 500},
+			{Target: TargetSource, Endpoint: EndpointGetRequest, Rate: rate(0), Status: 500},
+			{Target: TargetDestination, Endpoint: EndpointUpdate, Rate: rate(0.5), Status: 500},
+		},
+	})
+
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		for _, endpoint := range []string{EndpointRequest, EndpointGetRequest} {
+			counts[endpoint] += len(in.activate(TargetSource, endpoint).faults)
+		}
+		counts[EndpointUpdate] += len(in.activate(TargetDestination, EndpointUpdate).faults)
+	}
+	if counts[EndpointRequest] != 1000 {
+		t.Errorf("fault without rate is injected %d out of 1000 times, want always", counts[EndpointRequest])
+	}
+	if counts[EndpointGetRequest] != 0 {
+		t.Errorf("fault of zero rate is injected %d out of 1000 times, want never", counts[EndpointGetRequest])
+	}
+	if n := counts[EndpointUpdate]; n < 400 || n > 600 {
+		t.Errorf("fault of rate 0.5 is injected %d out of 1000 times", n)
+	}
+}
+
+func TestFaultsReproducedWhateverRequestsInterleave(t *testing.T) {
+	scenario := &Scenario{
+		Seed: 42,
+		Faults: []*Fault{
+			{Target: TargetSource, Rate: rate(0.3), Status: 503},
+			{Target: TargetSource, LatencyMin: time.Millisecond, LatencyMax: time.Second},
+			{Target: TargetSource, From: 10, To: 20, Rate: rate(0.5), DropSymbols: []string{"ETH"}},
+		},
+	}
+	const requests = 200
+	logger := newTestLogger(t)
+
+	sequential := make(map[int]string)
+	in := NewFaultInjector(logger, scenario)
+	for i := 0; i < requests; i++ {
+		active := in.activate(TargetSource, EndpointRequest)
+		sequential[active.n] = describeAll(active)
+	}
+
+	concurrent := make(map[int]string)
+	in = NewFaultInjector(logger, scenario)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			active := in.activate(TargetSource, EndpointRequest)
+			mu.Lock()
+			concurrent[active.n] = describeAll(active)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for n := 1; n <= requests; n++ {
+		if sequential[n] != concurrent[n] {
+			t.Errorf("request %d: faults are %q sequentially but %q concurrently", n, sequential[n], concurrent[n])
+		}
+	}
+}
+
+func describeAll(active *activeFaults) string {
+	var descs []string
+	for _, f := range active.faults {
+		descs = append(descs, f.describe())
+	}
+	return strings.Join(descs, "; ")
+}
+
+func TestCorruptedBody(t *testing.T) {
+	const body = `{"price_results":[{"symbol":"BTC"}]}`
+	tests := map[string]string{
+		"":            body,
+		BodyTruncated: body[:len(body)/2],
+		BodyGarbled:   `['price_results':[['symbol':'BTC'}]}`,
+	}
+	for corruption, want := range tests {
+		active := &activeFaults{faults: []*Fault{{Body: corruption}}}
+		rec := httptest.NewRecorder()
+		fw, ok := active.intercept(rec, httptest.NewRequest(http.MethodGet, "/request/1", nil))
+		if !ok {
+			t.Fatalf("%q: request is responded by intercept", corruption)
+		}
+		fw.Write([]byte(body))
+		fw.flush()
+		if got := rec.Body.String(); got != want {
+			t.Errorf("%q: body is %s, want %s", corruption, got, want)
+		}
+	}
+}
+
+func TestFaultStatus(t *testing.T) {
+	active := &activeFaults{faults: []*Fault{{Status: 503}}}
+	rec := httptest.NewRecorder()
+	if _, ok := active.intercept(rec, httptest.NewRequest(http.MethodPost, "/request", nil)); ok {
+		t.Fatalf("request is not responded by intercept")
+	}
+	if rec.Code != 503 {
+		t.Errorf("status is %d, want 503", rec.Code)
+	}
+}
@@ -0,0 +1,219 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NuttapolCha/test-band-data-feeder/log"
+)
+
+// DefaultInitialPrices are starting prices of the random walk, other symbols start at 100
+var DefaultInitialPrices = map[string]float64{
+	"BTC":   40000,
+	"ETH":   3000,
+	"ADA":   1.2,
+	"DOGE":  0.14,
+	"UST":   1,
+	"BAND":  5,
+	"ALPHA": 0.5,
+}
+
+type SourceConfig struct {
+	// requested pricing is pending until this long after it is requested
+	ResolveDelay time.Duration
+
+	// px is price * Multiplier
+	Multiplier int64
+
+	// every request moves the price of each symbol by up to this ratio
+	Volatility float64
+
+	InitialPrices map[string]float64
+	Seed          int64
+}
+
+type sourceRequest struct {
+	id          int
+	requestedAt time.Time
+	results     []*sourcePricingResult
+}
+
+type sourcePricingResult struct {
+	Multiplier  string `json:"multiplier"`
+	Px          string `json:"px"`
+	RequestID   string `json:"request_id"`
+	ResolveTime string `json:"resolve_time"`
+	Symbol      string `json:"symbol"`
+}
+
+// Source stands in for the data source, prices of every symbol walk randomly
+// from one request to the next.
+//
+//	POST /request      {"symbols": [...]} -> {"id": 1}
+//	GET  /request/{id} -> {"price_results": [...]} once resolved, {"status": "pending"} before
+type Source struct {
+	logger log.Logger
+	config SourceConfig
+	faults *FaultInjector
+
+	mu       sync.Mutex
+	rng      *rand.Rand
+	prices   map[string]float64
+	nextID   int
+	requests map[int]*sourceRequest
+}
+
+// NewSource returns a data source injecting faults, faults can be nil.
+func NewSource(logger log.Logger, config SourceConfig, faults *FaultInjector) *Source {
+	if config.Multiplier <= 0 {
+		config.Multiplier = 1000000000
+	}
+	if config.InitialPrices == nil {
+		config.InitialPrices = DefaultInitialPrices
+	}
+	if config.Seed == 0 {
+		config.Seed = time.Now().UnixNano()
+	}
+
+	return &Source{
+		logger:   logger,
+		config:   config,
+		faults:   faults,
+		rng:      rand.New(rand.NewSource(config.Seed)),
+		prices:   make(map[string]float64),
+		nextID:   1,
+		requests: make(map[int]*sourceRequest),
+	}
+}
+
+func (s *Source) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case path == "/request" && r.Method == http.MethodPost:
+		active := s.faults.activate(TargetSource, EndpointRequest)
+		fw, ok := active.intercept(w, r)
+		if !ok {
+			return
+		}
+		s.handleRequest(fw, r)
+		fw.flush()
+	case strings.HasPrefix(path, "/request/") && r.Method == http.MethodGet:
+		active := s.faults.activate(TargetSource, EndpointGetRequest)
+		fw, ok := active.intercept(w, r)
+		if !ok {
+			return
+		}
+		s.handleGetRequest(fw, r, strings.TrimPrefix(path, "/request/"), active)
+		fw.flush()
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Source) handleRequest(w http.ResponseWriter, r *http.Request) {
+	params := struct {
+		Symbols []string `json:"symbols"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(params.Symbols) == 0 {
+		http.Error(w, "symbols are required", http.StatusBadRequest)
+		return
+	}
+
+	req := s.newRequest(params.Symbols)
+	s.logger.Infof("SOURCE: request %d for %v resolves in %v", req.id, params.Symbols, s.config.ResolveDelay)
+	writeJSON(w, http.StatusOK, map[string]int{"id": req.id})
+}
+
+func (s *Source) handleGetRequest(w http.ResponseWriter, r *http.Request, rawID string, active *activeFaults) {
+	id, err := strconv.Atoi(rawID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid request id %q", rawID), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	req, ok := s.requests[id]
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("request %d not found", id), http.StatusNotFound)
+		return
+	}
+
+	if time.Since(req.requestedAt) < s.config.ResolveDelay {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"price_results": []*sourcePricingResult{},
+			"status":        "pending",
+		})
+		return
+	}
+	results := make([]*sourcePricingResult, 0, len(req.results))
+	for _, result := range req.results {
+		if !active.dropped(result.Symbol) {
+			results = append(results, result)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"price_results": results,
+	})
+}
+
+// newRequest walks prices of the symbols one step, the request resolves at them.
+func (s *Source) newRequest(symbols []string) *sourceRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	req := &sourceRequest{
+		id:          s.nextID,
+		requestedAt: now,
+	}
+	s.nextID++
+
+	resolveTime := now.Add(s.config.ResolveDelay).Unix()
+	for _, symbol := range symbols {
+		price := s.walk(symbol)
+		req.results = append(req.results, &sourcePricingResult{
+			Multiplier:  strconv.FormatInt(s.config.Multiplier, 10),
+			Px:          strconv.FormatInt(int64(math.Round(price*float64(s.config.Multiplier))), 10),
+			RequestID:   strconv.Itoa(req.id),
+			ResolveTime: strconv.FormatInt(resolveTime, 10),
+			Symbol:      symbol,
+		})
+	}
+	s.requests[req.id] = req
+	return req
+}
+
+// walk moves price of symbol by a random ratio within volatility, s.mu must be held.
+func (s *Source) walk(symbol string) float64 {
+	price, ok := s.prices[symbol]
+	if !ok {
+		price, ok = s.config.InitialPrices[symbol]
+		if !ok {
+			price = 100
+		}
+	}
+	price *= 1 + s.config.Volatility*(2*s.rng.Float64()-1)
+	if price <= 0 {
+		price = math.SmallestNonzeroFloat64
+	}
+	s.prices[symbol] = price
+	return price
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}